@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+	ScopeAlertsRead  = "alerts:read"
+	ScopeAlertsWrite = "alerts:write"
+	ScopeTxnsRead    = "txns:read"
+	ScopeTxnsWrite   = "txns:write"
+	ScopeAdmin       = "admin"
+)
+
+// Scopes lists every scope a key may be granted.
+var Scopes = []string{
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeAlertsRead,
+	ScopeAlertsWrite,
+	ScopeTxnsRead,
+	ScopeTxnsWrite,
+	ScopeAdmin,
+}
+
+// Principal is whoever presented the credential on a request.
+type Principal struct {
+	Kind   string   `json:"kind"`
+	ID     string   `json:"id"`
+	Scopes []string `json:"scopes"`
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type contextKey struct{}
+
+// identified carries the outcome of an authentication done earlier in the
+// middleware chain, so Require doesn't look the credential up twice.
+type identified struct {
+	principal *Principal
+	err       error
+}
+
+type identifiedKey struct{}
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidKey   = errors.New("invalid api key")
+)
+
+// FromContext returns the principal authenticated for this request, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok
+}
+
+// Identify authenticates the request's credential ahead of routing, for
+// middleware that needs to know who is calling. It returns the request
+// carrying the outcome, and the principal, or nil if the request has no
+// valid credential.
+func Identify(r *http.Request) (*http.Request, *Principal) {
+
+	principal, err := authenticate(r)
+
+	r = r.WithContext(context.WithValue(r.Context(), identifiedKey{}, identified{principal, err}))
+
+	if err != nil {
+		return r, nil
+	}
+
+	return r, principal
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Require wraps a handler so it only runs for a bearer credential holding
+// scope. The credential is either an API key or a user session token.
+// AUTH_ADMIN_KEY, when set, is accepted as an all-scopes key so the first
+// real keys can be minted.
+func Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, err := authenticateOnce(r)
+
+		if errors.Is(err, errMissingToken) || errors.Is(err, errInvalidKey) || errors.Is(err, ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="multimodal-db"`)
+			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			util.RespondWithError(w, 500, err.Error())
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			util.RespondWithError(w, http.StatusForbidden, "missing scope ["+scope+"]")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, principal)
+		ctx = database.WithActor(ctx, principal.Kind+":"+principal.ID)
+		if principal.Kind == "user" {
+			ctx = database.WithActingUser(ctx, principal.ID)
+		}
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func authenticateOnce(r *http.Request) (*Principal, error) {
+
+	if id, ok := r.Context().Value(identifiedKey{}).(identified); ok {
+		return id.principal, id.err
+	}
+
+	return authenticate(r)
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, errMissingToken
+	}
+
+	if admin := os.Getenv("AUTH_ADMIN_KEY"); admin != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return &Principal{Kind: "bootstrap", ID: "admin", Scopes: []string{ScopeAdmin}}, nil
+	}
+
+	if !strings.HasPrefix(token, database.APIKeyPrefix) {
+
+		claims, err := verifyToken(r.Context(), token, tokenAccess)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Principal{Kind: "user", ID: claims.Subject, Scopes: sessionScopes}, nil
+	}
+
+	keyDat, err := database.FindActiveAPIKey(r.Context(), token)
+
+	if errors.Is(err, database.ErrAPIKeyNotFound) {
+		return nil, errInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{Kind: "apikey", ID: keyDat.UUID, Scopes: keyDat.Scopes}, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	defaultReloadInterval = time.Minute
+)
+
+var Roles = []string{RoleAdmin, RoleOperator, RoleViewer}
+
+// policySnapshot is an immutable view of the policy and binding tables.
+// Reloads build a fresh one and swap it in, so readers never lock.
+type policySnapshot struct {
+	grants   map[string]map[string]bool // role -> "resource:action"
+	bindings map[string]string          // "kind:id" -> role
+}
+
+var policies atomic.Pointer[policySnapshot]
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// ReloadPolicies re-reads policies and role bindings from Postgres.
+func ReloadPolicies(ctx context.Context) error {
+
+	rows, err := database.LoadPolicies(ctx)
+	if err != nil {
+		return err
+	}
+
+	bindings, err := database.LoadRoleBindings(ctx)
+	if err != nil {
+		return err
+	}
+
+	snap := &policySnapshot{
+		grants:   map[string]map[string]bool{},
+		bindings: map[string]string{},
+	}
+
+	for _, p := range rows {
+		if snap.grants[p.Role] == nil {
+			snap.grants[p.Role] = map[string]bool{}
+		}
+		snap.grants[p.Role][p.Resource+":"+p.Action] = true
+	}
+
+	for _, b := range bindings {
+		snap.bindings[b.PrincipalKind+":"+b.PrincipalID] = b.Role
+	}
+
+	policies.Store(snap)
+
+	return nil
+}
+
+// StartPolicyReloader loads policies now and then again every
+// RBAC_RELOAD_INTERVAL (default 1m), so edits made by another instance or
+// straight in the database are picked up without a restart.
+func StartPolicyReloader() {
+
+	if err := ReloadPolicies(context.Background()); err != nil {
+		log.Fatal("Error loading RBAC policies:", err)
+	}
+
+	interval := util.EnvDuration("RBAC_RELOAD_INTERVAL", defaultReloadInterval)
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := ReloadPolicies(context.Background()); err != nil {
+				log.Println("Error reloading RBAC policies:", err)
+			}
+		}
+	}()
+}
+
+// Authorize wraps a handler so it only runs for a principal whose key
+// carries the matching scope and whose role is granted action on resource.
+// Resources without scopes of their own, such as keys or rbac, need the
+// admin scope.
+func Authorize(resource, action string, next http.HandlerFunc) http.HandlerFunc {
+
+	scope := resource + ":write"
+	if action == ActionRead {
+		scope = resource + ":read"
+	}
+	if !slices.Contains(Scopes, scope) {
+		scope = ScopeAdmin
+	}
+
+	return Require(scope, func(w http.ResponseWriter, r *http.Request) {
+
+		principal, _ := FromContext(r.Context())
+
+		allowed, err := principal.Can(resource, action)
+
+		if err != nil {
+			util.RespondWithError(w, 500, err.Error())
+			return
+		}
+		if !allowed {
+			util.RespondWithError(w, http.StatusForbidden,
+				fmt.Sprintf("role [%s] may not %s %s", principal.Role(), action, resource))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Role resolves the principal's role from its binding, falling back to
+// RBAC_DEFAULT_ROLE (default viewer) for principals with none.
+func (p *Principal) Role() string {
+
+	if p.Kind == "bootstrap" {
+		return RoleAdmin
+	}
+
+	if snap := policies.Load(); snap != nil {
+		if role, ok := snap.bindings[p.Kind+":"+p.ID]; ok {
+			return role
+		}
+	}
+
+	if role := os.Getenv("RBAC_DEFAULT_ROLE"); role != "" {
+		return role
+	}
+
+	return RoleViewer
+}
+
+func (p *Principal) Can(resource, action string) (bool, error) {
+
+	// Logged-in users may always edit their own record, whatever their
+	// role; the user store confines them to it.
+	if p.Kind == "user" && resource == "users" && action == ActionUpdate {
+		return true, nil
+	}
+
+	snap := policies.Load()
+	if snap == nil {
+		return false, fmt.Errorf("policies not loaded")
+	}
+
+	grants := snap.grants[p.Role()]
+
+	return grants[resource+":"+action] ||
+		grants[resource+":*"] ||
+		grants["*:"+action] ||
+		grants["*:*"], nil
+}
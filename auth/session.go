@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+// A logged-in user may read everything and write only to their own record;
+// the ownership half is enforced by the user store.
+var sessionScopes = []string{
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeAlertsRead,
+	ScopeTxnsRead,
+}
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type sessionClaims struct {
+	jwt.RegisteredClaims
+	Type string `json:"typ"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Login exchanges a user's name and password for a token pair.
+func Login(r *http.Request) (*TokenPair, error) {
+
+	var reqBody struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if reqBody.Name == "" || reqBody.Password == "" {
+		return nil, database.ErrInvalidCredentials
+	}
+
+	userDat, err := database.VerifyCredentials(r.Context(), reqBody.Name, reqBody.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(userDat.UUID)
+}
+
+// Refresh rotates a refresh token: the presented one is revoked and a new
+// pair is issued, so a stolen refresh token is only good once.
+func Refresh(r *http.Request) (*TokenPair, error) {
+
+	var reqBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+
+	claims, err := verifyToken(r.Context(), reqBody.RefreshToken, tokenRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	// The user may have been deleted since the token was issued.
+	if _, err := database.GetUserByUUID(r.Context(), claims.Subject); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := redisdb.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	return issueTokens(claims.Subject)
+}
+
+// Logout revokes the access token on the request and, if supplied in the
+// body, the matching refresh token.
+func Logout(r *http.Request) error {
+
+	token, ok := bearerToken(r)
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	claims, err := verifyToken(r.Context(), token, tokenAccess)
+	if err != nil {
+		return err
+	}
+
+	if err := redisdb.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	var reqBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if util.ParseBody(r, &reqBody) != nil || reqBody.RefreshToken == "" {
+		return nil
+	}
+
+	refresh, err := verifyToken(r.Context(), reqBody.RefreshToken, tokenRefresh)
+	if err != nil || refresh.Subject != claims.Subject {
+		return nil
+	}
+
+	return redisdb.RevokeToken(r.Context(), refresh.ID, refresh.ExpiresAt.Time)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func issueTokens(userUUID string) (*TokenPair, error) {
+
+	accessTTL := util.EnvDuration("AUTH_ACCESS_TTL", defaultAccessTTL)
+	refreshTTL := util.EnvDuration("AUTH_REFRESH_TTL", defaultRefreshTTL)
+
+	access, err := signToken(userUUID, tokenAccess, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := signToken(userUUID, tokenRefresh, refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTTL.Seconds()),
+	}, nil
+}
+
+func signToken(userUUID, tokenType string, ttl time.Duration) (string, error) {
+
+	secret, err := jwtSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := sessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userUUID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Type: tokenType,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// verifyToken checks signature, expiry, type and the revocation list.
+func verifyToken(ctx context.Context, raw, tokenType string) (*sessionClaims, error) {
+
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &sessionClaims{}
+
+	_, err = jwt.ParseWithClaims(raw, claims, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil || claims.Type != tokenType || claims.ID == "" || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	// Sessions are only issued when Redis holds the revocation list.
+	if !redisdb.Enabled() {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := redisdb.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func jwtSecret() ([]byte, error) {
+
+	secret := os.Getenv("AUTH_JWT_SECRET")
+
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("AUTH_JWT_SECRET must be set to at least 32 characters")
+	}
+
+	return []byte(secret), nil
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/i101dev/multimodal-db/leader"
+	badgerdb "github.com/i101dev/multimodal-db/models/badger"
+	"github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultUserRetention    = 30 * 24 * time.Hour
+	defaultUserPurgeEvery   = time.Hour
+	defaultOutboxRetention  = 7 * 24 * time.Hour
+	defaultAlertRetention   = 30 * 24 * time.Hour
+	defaultSilenceRetention = 24 * time.Hour
+)
+
+// registerBuiltins registers the service's own housekeeping. Any job's
+// schedule can be replaced with JOB_SCHEDULE_<NAME>, e.g.
+// JOB_SCHEDULE_ALERT_RETENTION="0 3 * * *", or "-" to only run it by hand.
+//
+//	user-purge       hard-deletes users soft-deleted longer than USER_PURGE_RETENTION (default 720h),
+//	                 every USER_PURGE_INTERVAL (default 1h)
+//	outbox-prune     drops published outbox events older than OUTBOX_RETENTION (default 168h), hourly
+//	alert-retention  deletes alerts resolved longer ago than ALERT_RETENTION (default 720h), daily,
+//	                 when Redis is configured
+//	silence-prune    deletes silences that ended longer ago than SILENCE_RETENTION (default 24h), hourly,
+//	                 when Redis is configured
+//	badger-gc        reclaims stale Badger value log space, every 10 minutes, on every instance
+func registerBuiltins() {
+
+	postgres.ConnectDB()
+	badgerdb.ConnectDB()
+
+	userRetention := util.EnvDuration("USER_PURGE_RETENTION", defaultUserRetention)
+	outboxRetention := util.EnvDuration("OUTBOX_RETENTION", defaultOutboxRetention)
+	alertRetention := util.EnvDuration("ALERT_RETENTION", defaultAlertRetention)
+	silenceRetention := util.EnvDuration("SILENCE_RETENTION", defaultSilenceRetention)
+
+	builtins := []Job{
+		{
+			Name:     "user-purge",
+			Schedule: "@every " + util.EnvDuration("USER_PURGE_INTERVAL", defaultUserPurgeEvery).String(),
+			Run: func(ctx context.Context, fence leader.Fence) error {
+				purged, err := postgres.PurgeDeletedUsers(ctx, time.Now().Add(-userRetention), fence)
+				if purged > 0 {
+					log.Printf("Purged %d deleted users", purged)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "outbox-prune",
+			Schedule: "@hourly",
+			Run: func(ctx context.Context, fence leader.Fence) error {
+				_, err := postgres.PruneOutbox(ctx, time.Now().Add(-outboxRetention), fence)
+				return err
+			},
+		},
+		{
+			Name:     "badger-gc",
+			Schedule: "*/10 * * * *",
+			Jitter:   time.Minute,
+			Local:    true,
+			Run: func(ctx context.Context, _ leader.Fence) error {
+				_, err := badgerdb.CollectGarbage(ctx)
+				return err
+			},
+		},
+	}
+
+	if redisdb.Configured() {
+
+		redisdb.ConnectDB()
+
+		builtins = append(builtins, Job{
+			Name:     "alert-retention",
+			Schedule: "@daily",
+			Timeout:  30 * time.Minute,
+			Run: func(ctx context.Context, fence leader.Fence) error {
+				purged, err := redisdb.PurgeResolvedAlerts(ctx, time.Now().Add(-alertRetention), fence)
+				if purged > 0 {
+					log.Printf("Purged %d resolved alerts", purged)
+				}
+				return err
+			},
+		}, Job{
+			Name:     "silence-prune",
+			Schedule: "@hourly",
+			Run: func(ctx context.Context, fence leader.Fence) error {
+				_, err := redisdb.PruneSilences(ctx, time.Now().Add(-silenceRetention), fence)
+				return err
+			},
+		})
+	}
+
+	for _, job := range builtins {
+
+		env := "JOB_SCHEDULE_" + strings.ToUpper(strings.ReplaceAll(job.Name, "-", "_"))
+		if schedule := os.Getenv(env); schedule != "" {
+			job.Schedule = schedule
+		}
+
+		if err := Register(job); err != nil {
+			log.Fatal("Error registering job:", err)
+		}
+	}
+}
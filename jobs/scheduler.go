@@ -0,0 +1,405 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/i101dev/multimodal-db/leader"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultTimeout = 5 * time.Minute
+	electionTTL    = 15 * time.Second
+	jobLeaseTTL    = 30 * time.Second
+)
+
+const (
+	ResultOK      = "ok"
+	ResultError   = "error"
+	ResultTimeout = "timeout"
+
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job already running")
+)
+
+// Job is a unit of periodic work.
+//
+// Schedule is a five-field cron expression ("*/10 * * * *") or a
+// descriptor such as "@hourly" or "@every 15m"; "-" means the job only
+// runs when triggered by hand. Each run starts up to Jitter after its
+// scheduled time and is cancelled after Timeout (default 5m).
+//
+// Scheduled runs happen only on the instance elected to lead the
+// scheduler, unless Local is set, for work on per-instance state that
+// every instance has to do for itself. A run never overlaps another run
+// of the same job on this instance. Unless Local, it also holds a lease
+// on the job for as long as it runs, and is cancelled if the lease is
+// lost; Run gets the lease's fence to hand to the stores it writes to, so
+// a run that carries on regardless can't overwrite a later one's work.
+// Local runs get the zero Fence.
+type Job struct {
+	Name     string
+	Schedule string
+	Timeout  time.Duration
+	Jitter   time.Duration
+	Local    bool
+	Run      func(ctx context.Context, fence leader.Fence) error
+}
+
+// Status is a job's configuration and, as seen from this instance, its
+// latest run.
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Timeout  string `json:"timeout"`
+	Jitter   string `json:"jitter,omitempty"`
+	Local    bool   `json:"local"`
+
+	ScheduledHere bool       `json:"scheduled_here"`
+	Running       bool       `json:"running"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastTrigger  string     `json:"last_trigger,omitempty"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	Skipped  int `json:"skipped"`
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+
+	// Guarded by mu.
+	status Status
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]*entry{}
+	started  bool
+
+	election *leader.Election
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Register adds a job. Jobs registered after Start are scheduled at once.
+func Register(job Job) error {
+
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("invalid job: needs a name and a run function")
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	var schedule cron.Schedule
+	if job.Schedule != "-" {
+		s, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule for job %s: %v", job.Name, err)
+		}
+		schedule = s
+	}
+
+	// -------------------------------------------------------------
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := registry[job.Name]; exists {
+		return fmt.Errorf("job %s already registered", job.Name)
+	}
+
+	e := &entry{job: job, schedule: schedule}
+	e.status = Status{
+		Name:     job.Name,
+		Schedule: job.Schedule,
+		Timeout:  job.Timeout.String(),
+		Local:    job.Local,
+	}
+	if job.Jitter > 0 {
+		e.status.Jitter = job.Jitter.String()
+	}
+
+	registry[job.Name] = e
+
+	if started {
+		go e.loop()
+	}
+
+	return nil
+}
+
+// Start campaigns for leadership of the scheduler and starts every
+// registered job's schedule, along with the built-in jobs.
+func Start() {
+
+	mu.Lock()
+	if started {
+		mu.Unlock()
+		return
+	}
+	mu.Unlock()
+
+	registerBuiltins()
+	schedule()
+}
+
+// schedule starts the registered jobs without the built-ins, which need
+// the stores connected.
+func schedule() {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if started {
+		return
+	}
+	started = true
+
+	election = leader.Campaign("job-scheduler", electionTTL)
+
+	for _, e := range registry {
+		go e.loop()
+	}
+}
+
+// List reports every job's status, by name.
+func List() []Status {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	statuses := make([]Status, 0, len(registry))
+
+	for _, e := range registry {
+		s := e.status
+		s.ScheduledHere = e.schedule != nil && (e.job.Local || isLeader())
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// Trigger starts a run of the named job on this instance now, whatever
+// its schedule, and returns once the run has started.
+func Trigger(name string) (*Status, error) {
+
+	mu.Lock()
+	e, ok := registry[name]
+	mu.Unlock()
+
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	lease, err := e.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	go e.run(lease, TriggerManual)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	status := e.status
+
+	return &status, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// loop runs the job at each scheduled time, if this instance is meant to.
+func (e *entry) loop() {
+
+	if e.schedule == nil {
+		return
+	}
+
+	for {
+		next := e.schedule.Next(time.Now())
+
+		mu.Lock()
+		e.status.NextRun = &next
+		mu.Unlock()
+
+		delay := time.Until(next)
+		if e.job.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(e.job.Jitter)))
+		}
+		time.Sleep(delay)
+
+		if !e.job.Local && !isLeader() {
+			continue
+		}
+
+		lease, err := e.begin()
+		if err != nil {
+			if !errors.Is(err, ErrJobRunning) {
+				log.Printf("Error starting job %s: %v", e.job.Name, err)
+			}
+			continue
+		}
+
+		e.run(lease, TriggerSchedule)
+	}
+}
+
+// begin claims the job for one run: locally, and across instances through
+// a lease unless the job is Local. A run that can't be claimed counts as
+// skipped.
+func (e *entry) begin() (leader.Lease, error) {
+
+	mu.Lock()
+	if e.status.Running {
+		e.status.Skipped++
+		mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	e.status.Running = true
+	mu.Unlock()
+
+	if e.job.Local {
+		return nil, nil
+	}
+
+	// -------------------------------------------------------------
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lease, err := leader.Acquire(ctx, e.lockName(), jobLeaseTTL)
+	if err == nil {
+		return lease, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	e.status.Running = false
+
+	if errors.Is(err, leader.ErrHeld) {
+		e.status.Skipped++
+		return nil, ErrJobRunning
+	}
+
+	return nil, err
+}
+
+// run executes a claimed run and records how it went.
+func (e *entry) run(lease leader.Lease, trigger string) {
+
+	start := time.Now()
+
+	held, lose := context.WithCancelCause(context.Background())
+	ctx, cancel := context.WithTimeout(held, e.job.Timeout)
+
+	var fence leader.Fence
+	if lease != nil {
+		fence = leader.Fence{Lock: e.lockName(), Token: lease.Fence()}
+		go e.hold(ctx, lease, lose)
+	}
+
+	err := e.job.Run(ctx, fence)
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	if lost := context.Cause(held); err != nil && lost != nil {
+		err = fmt.Errorf("%v (%v)", err, lost)
+	}
+	cancel()
+	lose(nil)
+
+	if lease != nil {
+		if err := lease.Release(context.Background()); err != nil && !errors.Is(err, leader.ErrLost) {
+			log.Printf("Error releasing job %s: %v", e.job.Name, err)
+		}
+	}
+
+	// -------------------------------------------------------------
+	mu.Lock()
+	defer mu.Unlock()
+
+	e.status.Running = false
+	e.status.Runs++
+	e.status.LastRun = &start
+	e.status.LastTrigger = trigger
+	e.status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	e.status.LastResult, e.status.LastError = ResultOK, ""
+
+	if err != nil {
+		e.status.Failures++
+		e.status.LastResult, e.status.LastError = ResultError, err.Error()
+		if timedOut {
+			e.status.LastResult = ResultTimeout
+		}
+		log.Printf("Job %s failed: %v", e.job.Name, err)
+	}
+}
+
+// hold refreshes a run's lease until the run ends, and ends the run if
+// the lease is lost. Refreshes that fail for other reasons are retried;
+// if they keep failing the lease expires and the next one finds it lost.
+func (e *entry) hold(ctx context.Context, lease leader.Lease, lose context.CancelCauseFunc) {
+
+	ticker := time.NewTicker(jobLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			refreshCtx, cancel := context.WithTimeout(ctx, jobLeaseTTL/3)
+			err := lease.Refresh(refreshCtx, jobLeaseTTL)
+			cancel()
+
+			if errors.Is(err, leader.ErrLost) {
+				log.Printf("Job %s lost its lease; stopping", e.job.Name)
+				lose(err)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error refreshing lease on job %s: %v", e.job.Name, err)
+			}
+		}
+	}
+}
+
+func (e *entry) lockName() string {
+	return "job:" + e.job.Name
+}
+
+func isLeader() bool {
+	if election == nil {
+		return false
+	}
+	_, _, ok := election.Leader()
+	return ok
+}
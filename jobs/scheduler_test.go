@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/i101dev/multimodal-db/leader"
+)
+
+// Nothing here sets a shared locker, so every lease and the scheduler's
+// election come from leader's in-process one, as they do without Redis.
+
+func register(t *testing.T, job Job) {
+	t.Helper()
+	if err := Register(job); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFence(t *testing.T, fences <-chan leader.Fence) leader.Fence {
+	t.Helper()
+	select {
+	case fence := <-fences:
+		return fence
+	case <-time.After(5 * time.Second):
+		t.Fatal("job didn't run")
+	}
+	return leader.Fence{}
+}
+
+func status(name string) Status {
+	for _, s := range List() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return Status{}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func TestScheduledJobRunsUnderLocalLocker(t *testing.T) {
+
+	fences := make(chan leader.Fence, 10)
+
+	register(t, Job{
+		Name:     "local-scheduled",
+		Schedule: "@every 1s",
+		Run: func(_ context.Context, fence leader.Fence) error {
+			fences <- fence
+			return nil
+		},
+	})
+	schedule()
+
+	first := waitFence(t, fences)
+	second := waitFence(t, fences)
+
+	if first.Lock != "job:local-scheduled" || second.Lock != first.Lock {
+		t.Fatalf("runs fenced on %q and %q, want job:local-scheduled", first.Lock, second.Lock)
+	}
+	if first.Token < 1 || second.Token <= first.Token {
+		t.Fatalf("fencing tokens %d then %d, want rising tokens", first.Token, second.Token)
+	}
+	if !status("local-scheduled").ScheduledHere {
+		t.Fatal("the only instance isn't leading the scheduler")
+	}
+}
+
+func TestTriggerWhileRunningSkipped(t *testing.T) {
+
+	started := make(chan leader.Fence, 1)
+	release := make(chan struct{})
+
+	register(t, Job{
+		Name:     "local-manual",
+		Schedule: "-",
+		Run: func(_ context.Context, fence leader.Fence) error {
+			started <- fence
+			<-release
+			return nil
+		},
+	})
+	schedule()
+
+	if _, err := Trigger("local-manual"); err != nil {
+		t.Fatal(err)
+	}
+	fence := waitFence(t, started)
+
+	if fence.Lock != "job:local-manual" || fence.Token < 1 {
+		t.Fatalf("manual run got fence %+v, want a lease on job:local-manual", fence)
+	}
+	if _, err := Trigger("local-manual"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("second trigger returned %v, want ErrJobRunning", err)
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status("local-manual").Running {
+		if time.Now().After(deadline) {
+			t.Fatal("run didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s := status("local-manual")
+	if s.Runs != 1 || s.Skipped != 1 || s.LastResult != ResultOK || s.LastTrigger != TriggerManual {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+
+	// The lease was released with the run, so the next one gets it.
+	if _, err := Trigger("local-manual"); err != nil {
+		t.Fatalf("trigger after the run returned %v", err)
+	}
+	if next := waitFence(t, started); next.Token <= fence.Token {
+		t.Fatalf("next run fenced with %d, want more than %d", next.Token, fence.Token)
+	}
+}
+
+func TestLocalJobGetsZeroFence(t *testing.T) {
+
+	fences := make(chan leader.Fence, 1)
+
+	register(t, Job{
+		Name:     "local-only",
+		Schedule: "-",
+		Local:    true,
+		Run: func(_ context.Context, fence leader.Fence) error {
+			fences <- fence
+			return nil
+		},
+	})
+
+	if _, err := Trigger("local-only"); err != nil {
+		t.Fatal(err)
+	}
+	if fence := waitFence(t, fences); fence != (leader.Fence{}) {
+		t.Fatalf("local job got fence %+v, want the zero Fence", fence)
+	}
+}
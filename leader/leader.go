@@ -0,0 +1,155 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	ErrHeld       = errors.New("lock held by another owner")
+	ErrLost       = errors.New("lock lost")
+	ErrStaleFence = errors.New("fencing token superseded by a later lock holder")
+)
+
+// Locker hands out leases on named locks. Every lease on a name carries a
+// fencing token larger than any before it.
+type Locker interface {
+	Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error)
+}
+
+type Lease interface {
+	Fence() int64
+	Refresh(ctx context.Context, ttl time.Duration) error
+	Release(ctx context.Context) error
+}
+
+// Fence is a lease's fencing token along with the lock it was issued on.
+// Stores that take one remember the highest token they've accepted per
+// lock and fail writes under a lower one with ErrStaleFence, so a holder
+// whose lease has passed to someone else can't overwrite their work. The
+// zero Fence, for work done without a lease, isn't checked.
+type Fence struct {
+	Lock  string
+	Token int64
+}
+
+var (
+	lockerMu sync.RWMutex
+	locker   Locker = newLocalLocker()
+)
+
+// SetLocker replaces the in-process locker, which only coordinates within
+// this instance, with a shared one.
+func SetLocker(l Locker) {
+	lockerMu.Lock()
+	defer lockerMu.Unlock()
+	locker = l
+}
+
+func currentLocker() Locker {
+	lockerMu.RLock()
+	defer lockerMu.RUnlock()
+	return locker
+}
+
+// Acquire takes a lease on name from the current locker, failing with
+// ErrHeld if someone else has it.
+func Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	return currentLocker().Acquire(ctx, name, ttl)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Election keeps this instance campaigning for the lease on a name, and
+// renewing it while it leads.
+type Election struct {
+	name string
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	lease  Lease
+	locker Locker
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Campaign starts campaigning for name in the background. A leader that
+// can't renew its lease within ttl steps down.
+func Campaign(name string, ttl time.Duration) *Election {
+
+	e := &Election{name: name, ttl: ttl}
+
+	go func() {
+		e.step()
+		for range time.Tick(ttl / 3) {
+			e.step()
+		}
+	}()
+
+	return e
+}
+
+// Leader reports whether this instance leads, with a context that is
+// cancelled as soon as it stops leading and the lease's fencing token.
+func (e *Election) Leader() (context.Context, int64, bool) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lease == nil {
+		return nil, 0, false
+	}
+
+	return e.ctx, e.lease.Fence(), true
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func (e *Election) step() {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+
+	current := currentLocker()
+
+	if e.lease != nil {
+
+		// A lease from the in-process locker means nothing to a shared one.
+		if e.locker != current {
+			e.lease.Release(ctx)
+			e.stepDown()
+		} else if err := e.lease.Refresh(ctx, e.ttl); err != nil {
+			log.Printf("Lost leadership of %s: %v", e.name, err)
+			e.stepDown()
+		} else {
+			return
+		}
+	}
+
+	lease, err := current.Acquire(ctx, e.name, e.ttl)
+	if err != nil {
+		if !errors.Is(err, ErrHeld) {
+			log.Printf("Error campaigning for %s: %v", e.name, err)
+		}
+		return
+	}
+
+	e.lease, e.locker = lease, current
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+}
+
+func (e *Election) stepDown() {
+	e.cancel()
+	e.lease, e.locker, e.ctx, e.cancel = nil, nil, nil, nil
+}
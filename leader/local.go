@@ -0,0 +1,82 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// localLocker coordinates goroutines within this instance only. It stands
+// in when there is no shared locker, where this instance is the only one
+// that matters.
+type localLocker struct {
+	mu     sync.Mutex
+	held   map[string]*localLease
+	fences map[string]int64
+}
+
+type localLease struct {
+	locker  *localLocker
+	name    string
+	fence   int64
+	expires time.Time
+}
+
+func newLocalLocker() *localLocker {
+	return &localLocker{held: map[string]*localLease{}, fences: map[string]int64{}}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func (l *localLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if held, ok := l.held[name]; ok && time.Now().Before(held.expires) {
+		return nil, ErrHeld
+	}
+
+	l.fences[name]++
+
+	lease := &localLease{locker: l, name: name, fence: l.fences[name], expires: time.Now().Add(ttl)}
+	l.held[name] = lease
+
+	return lease, nil
+}
+
+func (ll *localLease) Fence() int64 {
+	return ll.fence
+}
+
+func (ll *localLease) Refresh(ctx context.Context, ttl time.Duration) error {
+
+	ll.locker.mu.Lock()
+	defer ll.locker.mu.Unlock()
+
+	if ll.locker.held[ll.name] != ll || time.Now().After(ll.expires) {
+		return ErrLost
+	}
+
+	ll.expires = time.Now().Add(ttl)
+
+	return nil
+}
+
+func (ll *localLease) Release(ctx context.Context) error {
+
+	ll.locker.mu.Lock()
+	defer ll.locker.mu.Unlock()
+
+	if ll.locker.held[ll.name] != ll {
+		return ErrLost
+	}
+
+	delete(ll.locker.held, ll.name)
+
+	return nil
+}
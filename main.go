@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,7 +9,15 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"github.com/i101dev/multimodal-db/jobs"
+	"github.com/i101dev/multimodal-db/metrics"
+	"github.com/i101dev/multimodal-db/middleware"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/outbox"
 	"github.com/i101dev/multimodal-db/routes"
+	"github.com/i101dev/multimodal-db/rules"
+	"github.com/i101dev/multimodal-db/tracing"
+	"github.com/i101dev/multimodal-db/webhooks"
 )
 
 func init() {
@@ -25,30 +34,69 @@ func main() {
 		log.Fatal("Invalid port - not found in environment")
 	}
 
+	// -----------------------------------------------------------------------
+	// Telemetry Setup
+	//
+	tracing.Init()
+
 	// -----------------------------------------------------------------------
 	// Server Setup
 	//
 	fileServer := http.FileServer(http.Dir("./static"))
 	http.Handle("/", fileServer)
 
+	mux := http.DefaultServeMux
+
+	var handler http.Handler = mux
+	handler = middleware.RateLimit(mux, handler)
+	handler = middleware.Timeout(mux, handler)
+	handler = tracing.Middleware(mux, handler)
+	handler = metrics.Middleware(mux, handler)
+	handler = middleware.RequestID(handler)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: http.DefaultServeMux,
+		Handler: handler,
 	}
 
 	// -----------------------------------------------------------------------
 	// Routing Setup
 	//
 	// routes.RegisterTestRoutes()
+	routes.RegisterMetricsRoutes()
+	routes.RegisterKeyRoutes()
+	routes.RegisterRBACRoutes()
 	routes.RegisterUserRoutes()
-	// routes.RegisterAlertRoutes()
-	// routes.RegisterTxnRoutes()
+	routes.RegisterAuditRoutes()
+	routes.RegisterRuleRoutes()
+	routes.RegisterJobRoutes()
+	routes.RegisterTxnRoutes()
+
+	// Sessions, alerts and webhooks live in Redis; without it only API
+	// keys authenticate.
+	if redisdb.Configured() {
+		routes.RegisterAuthRoutes()
+		routes.RegisterWebhookRoutes()
+		routes.RegisterAlertRoutes()
+	}
+
+	// -----------------------------------------------------------------------
+	// Workers
+	//
+	outbox.StartRelay()
+	jobs.Start()
+
+	if redisdb.Configured() {
+		rules.Start()
+		webhooks.StartDispatcher()
+	}
 
 	// -----------------------------------------------------------------------
 	// Server Launch
 	//
 	fmt.Println("Server is live on port:", port)
 	if err := srv.ListenAndServe(); err != nil {
+		tracing.Shutdown(context.Background())
 		log.Fatal(err)
 	}
 }
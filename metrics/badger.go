@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/ristretto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	badgerLSMSize = prometheus.NewDesc(
+		"badger_lsm_size_bytes", "Size of the Badger LSM tree.", nil, nil)
+
+	badgerVlogSize = prometheus.NewDesc(
+		"badger_vlog_size_bytes", "Size of the Badger value log.", nil, nil)
+
+	badgerCacheHits = prometheus.NewDesc(
+		"badger_cache_hits_total", "Badger cache hits, by cache.", []string{"cache"}, nil)
+
+	badgerCacheMisses = prometheus.NewDesc(
+		"badger_cache_misses_total", "Badger cache misses, by cache.", []string{"cache"}, nil)
+
+	badgerCacheRatio = prometheus.NewDesc(
+		"badger_cache_hit_ratio", "Badger cache hit ratio, by cache.", []string{"cache"}, nil)
+)
+
+// RegisterBadger exposes size and cache statistics for db, read at scrape time.
+func RegisterBadger(db *badger.DB) {
+	prometheus.MustRegister(&badgerCollector{db: db})
+}
+
+type badgerCollector struct {
+	db *badger.DB
+}
+
+func (c *badgerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- badgerLSMSize
+	ch <- badgerVlogSize
+	ch <- badgerCacheHits
+	ch <- badgerCacheMisses
+	ch <- badgerCacheRatio
+}
+
+func (c *badgerCollector) Collect(ch chan<- prometheus.Metric) {
+
+	if c.db.IsClosed() {
+		return
+	}
+
+	lsm, vlog := c.db.Size()
+	ch <- prometheus.MustNewConstMetric(badgerLSMSize, prometheus.GaugeValue, float64(lsm))
+	ch <- prometheus.MustNewConstMetric(badgerVlogSize, prometheus.GaugeValue, float64(vlog))
+
+	collectCache(ch, "block", c.db.BlockCacheMetrics())
+	collectCache(ch, "index", c.db.IndexCacheMetrics())
+}
+
+// Caches that are disabled in the options report nil metrics.
+func collectCache(ch chan<- prometheus.Metric, cache string, m *ristretto.Metrics) {
+
+	if m == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(badgerCacheHits, prometheus.CounterValue, float64(m.Hits()), cache)
+	ch <- prometheus.MustNewConstMetric(badgerCacheMisses, prometheus.CounterValue, float64(m.Misses()), cache)
+	ch <- prometheus.MustNewConstMetric(badgerCacheRatio, prometheus.GaugeValue, m.Ratio(), cache)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const gormStartKey = "metrics:start"
+
+// GormPlugin times every gorm statement. Store names the backing database
+// ("postgres", "mysql") and becomes the "store" label.
+type GormPlugin struct {
+	Store string
+}
+
+func (p GormPlugin) Name() string {
+	return "metrics:" + p.Store
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register(p.Name()+":before_create", p.before); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register(p.Name()+":after_create", p.after("create")); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(p.Name()+":before_query", p.before); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register(p.Name()+":after_query", p.after("query")); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(p.Name()+":before_update", p.before); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register(p.Name()+":after_update", p.after("update")); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register(p.Name()+":before_delete", p.before); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register(p.Name()+":after_delete", p.after("delete")); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(p.Name()+":before_row", p.before); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register(p.Name()+":after_row", p.after("row")); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register(p.Name()+":before_raw", p.before); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register(p.Name()+":after_raw", p.after("raw"))
+}
+
+func (p GormPlugin) before(tx *gorm.DB) {
+	tx.InstanceSet(gormStartKey, time.Now())
+}
+
+func (p GormPlugin) after(operation string) func(*gorm.DB) {
+
+	return func(tx *gorm.DB) {
+
+		v, ok := tx.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+
+		// A missing row is an answer, not a datastore failure.
+		err := tx.Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+
+		ObserveDB(p.Store, operation, v.(time.Time), err)
+	}
+}
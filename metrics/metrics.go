@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_operation_duration_seconds",
+		Help:    "Datastore operation latency, by store and operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"store", "operation"})
+
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_operation_errors_total",
+		Help: "Datastore operations that returned an error, by store and operation.",
+	}, []string{"store", "operation"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Cache lookups, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+)
+
+// The default registry already carries the Go runtime and process
+// collectors, so registering ours there gives /metrics everything.
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, dbDuration, dbErrors, cacheLookups)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Handler serves every registered collector in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records a request counter and latency histogram for each
+// request. Requests are labelled with the mux pattern they matched rather
+// than the raw path so unknown URLs can't blow up label cardinality.
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		rec := util.NewStatusRecorder(w)
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status)).Inc()
+	})
+}
+
+// ObserveDB records the outcome of a single datastore operation.
+func ObserveDB(store, operation string, start time.Time, err error) {
+
+	dbDuration.WithLabelValues(store, operation).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		dbErrors.WithLabelValues(store, operation).Inc()
+	}
+}
+
+// ObserveCache counts one cache lookup as a hit or a miss.
+func ObserveCache(cache string, hit bool) {
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// RedisHook times every go-redis command and pipeline. Commands are
+// labelled by name (get, set, keys...), pipelines as "pipeline".
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := next(ctx, network, addr)
+		ObserveDB("redis", "dial", start, err)
+		return conn, err
+	}
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		ObserveDB("redis", cmd.Name(), start, redisErr(err))
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		ObserveDB("redis", "pipeline", start, redisErr(err))
+		return err
+	}
+}
+
+// redis.Nil only means the key wasn't there.
+func redisErr(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
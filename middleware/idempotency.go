@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/i101dev/multimodal-db/auth"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLen  = 255
+
+	// A reservation outlives the request's deadline by a little, and
+	// lasts this long for a request without one.
+	reservationSlack        = 5 * time.Second
+	defaultReservationLease = time.Minute
+)
+
+// Idempotent makes a create handler safe to retry. When the request carries
+// an Idempotency-Key header, the first response is stored in Redis and
+// replayed for any retry with the same key and body. Reusing a key with a
+// different body is a 422; retrying while the first attempt is still in
+// flight is a 409. Server errors aren't stored, so they can be retried.
+// Replays carry the headers the handler set, such as ETag. Without Redis
+// the header is ignored.
+//
+//	IDEMPOTENCY_TTL  how long responses are kept (default 24h)
+func Idempotent(next http.HandlerFunc) http.HandlerFunc {
+
+	if redisdb.Configured() {
+		redisdb.ConnectDB()
+	}
+
+	ttl := util.EnvDuration("IDEMPOTENCY_TTL", defaultIdempotencyTTL)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		idemKey := r.Header.Get("Idempotency-Key")
+
+		if idemKey == "" || !redisdb.Enabled() {
+			next(w, r)
+			return
+		}
+		if len(idemKey) > maxIdempotencyKeyLen {
+			util.RespondWithError(w, http.StatusBadRequest, "invalid Idempotency-Key")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+
+		// Keys are private to whoever made the request.
+		owner := "anonymous"
+		if p, ok := auth.FromContext(r.Context()); ok {
+			owner = p.Kind + ":" + p.ID
+		}
+		key := owner + ":" + r.URL.Path + ":" + idemKey
+
+		// ----------------------------------------------------------------
+		lease := defaultReservationLease
+		if deadline, ok := r.Context().Deadline(); ok {
+			lease = time.Until(deadline) + reservationSlack
+		}
+
+		stored, reserved, err := redisdb.ReserveIdempotencyKey(r.Context(), key, bodyHash, lease)
+
+		if err != nil {
+			util.RespondWithError(w, 500, err.Error())
+			return
+		}
+
+		if !reserved {
+			switch {
+			case stored.BodyHash != bodyHash:
+				util.RespondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request body")
+			case stored.Pending:
+				util.RespondWithError(w, http.StatusConflict, "a request with this Idempotency-Key is already in progress")
+			default:
+				for k, v := range stored.Header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+			}
+			return
+		}
+
+		// ----------------------------------------------------------------
+		before := w.Header().Clone()
+
+		rec := &captureWriter{StatusRecorder: util.NewStatusRecorder(w)}
+		next(rec, r)
+
+		// The handler's context may be about to expire; bookkeeping
+		// shouldn't fail because of that.
+		ctx := context.WithoutCancel(r.Context())
+
+		if rec.Status >= 500 {
+			if err := redisdb.ReleaseIdempotencyKey(ctx, key); err != nil {
+				log.Println("failed to release idempotency key:", err)
+			}
+			return
+		}
+
+		// Only what the handler set; headers from the middleware around
+		// this one are set afresh on every response.
+		header := map[string][]string{}
+		for k, v := range rec.Header() {
+			if !slices.Equal(before[k], v) {
+				header[k] = v
+			}
+		}
+
+		err = redisdb.SaveIdempotentResponse(ctx, key, &redisdb.IdempotentResponse{
+			BodyHash: bodyHash,
+			Status:   rec.Status,
+			Header:   header,
+			Body:     rec.body.Bytes(),
+		}, ttl)
+
+		if err != nil {
+			log.Println("failed to store idempotent response:", err)
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// captureWriter passes the response through while keeping a copy.
+type captureWriter struct {
+	*util.StatusRecorder
+	body bytes.Buffer
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	c.body.Write(b)
+	return c.StatusRecorder.Write(b)
+}
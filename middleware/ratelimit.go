@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i101dev/multimodal-db/auth"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// limit is a token bucket: capacity tokens, refilled at capacity per period.
+type limit struct {
+	capacity float64
+	period   time.Duration
+}
+
+func (l limit) ratePerMs() float64 {
+	return l.capacity / float64(l.period.Milliseconds())
+}
+
+var defaultLimit = limit{capacity: 60, period: time.Minute}
+
+// RateLimit applies a token bucket per client and route group. Clients are
+// identified by the API key or user behind a valid bearer credential, else
+// by IP, so made-up credentials don't earn fresh buckets. Buckets live in
+// Redis when it's configured, so limits hold across instances; without
+// Redis, or while it can't be reached, each instance keeps its own in
+// memory.
+//
+//	RATE_LIMITS             per-group limits, e.g. "default=60/1m,users=10/1s"
+//	RATE_LIMIT_TRUST_PROXY  "true" to key on X-Forwarded-For
+//
+// A route's group is the first segment of its path: "/users/create" is in
+// "users". Groups without an entry use "default".
+func RateLimit(mux *http.ServeMux, next http.Handler) http.Handler {
+
+	if redisdb.Configured() {
+		redisdb.ConnectDB()
+	}
+
+	limits := loadLimits()
+	local := &memoryBuckets{buckets: map[string]*memoryBucket{}}
+	trustProxy := os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		_, route := mux.Handler(r)
+		group := routeGroup(route)
+
+		l, ok := limits[group]
+		if !ok {
+			l = limits["default"]
+		}
+
+		r, principal := auth.Identify(r)
+
+		key := group + ":" + clientKey(r, principal, trustProxy)
+
+		var allowed bool
+		var tokens float64
+		var err error
+
+		if redisdb.Enabled() {
+			allowed, tokens, err = redisdb.TakeToken(r.Context(), key, l.capacity, l.ratePerMs())
+		}
+		if !redisdb.Enabled() || err != nil {
+			if err != nil {
+				log.Println("rate limit falling back to memory:", err)
+			}
+			allowed, tokens = local.take(key, l)
+		}
+
+		// ----------------------------------------------------------------
+		// https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+		//
+		refill := time.Duration((l.capacity - tokens) / l.ratePerMs() * float64(time.Millisecond))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(int(l.capacity)))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(refill.Seconds()))))
+
+		if !allowed {
+			wait := time.Duration((1 - tokens) / l.ratePerMs() * float64(time.Millisecond))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			util.RespondWithError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+type memoryBuckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSwept time.Time
+}
+
+func (m *memoryBuckets) take(key string, l limit) (bool, float64) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: l.capacity, last: now, period: l.period}
+		m.buckets[key] = b
+	}
+
+	elapsed := float64(now.Sub(b.last).Milliseconds())
+	b.tokens = math.Min(l.capacity, b.tokens+elapsed*l.ratePerMs())
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, b.tokens
+	}
+
+	b.tokens--
+	return true, b.tokens
+}
+
+// Buckets untouched for a full period are back at capacity, which is the
+// same as not existing, so they can go.
+func (m *memoryBuckets) sweep(now time.Time) {
+
+	if now.Sub(m.lastSwept) < time.Minute {
+		return
+	}
+	m.lastSwept = now
+
+	for key, b := range m.buckets {
+		if now.Sub(b.last) > b.period {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Only principals that authenticated get a bucket of their own; the key
+// names them by ID, never by the credential itself.
+func clientKey(r *http.Request, principal *auth.Principal, trustProxy bool) string {
+
+	if principal != nil {
+		return principal.Kind + ":" + principal.ID
+	}
+
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return "ip:" + strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// routeGroup reduces a mux pattern such as "/users/create" or
+// "PATCH /users/{uuid}" to its first path segment.
+func routeGroup(pattern string) string {
+
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+
+	segment, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+	if segment == "" {
+		return "default"
+	}
+
+	return segment
+}
+
+func loadLimits() map[string]limit {
+
+	limits := map[string]limit{"default": defaultLimit}
+
+	for _, entry := range strings.Split(os.Getenv("RATE_LIMITS"), ",") {
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, spec, ok := strings.Cut(entry, "=")
+		count, period, ok2 := strings.Cut(spec, "/")
+		if !ok || !ok2 {
+			log.Fatalf("invalid RATE_LIMITS entry %q", entry)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid RATE_LIMITS entry %q", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(period))
+		if err != nil || d < time.Millisecond {
+			log.Fatalf("invalid RATE_LIMITS entry %q", entry)
+		}
+
+		limits[strings.TrimSpace(group)] = limit{capacity: float64(n), period: d}
+	}
+
+	return limits
+}
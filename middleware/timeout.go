@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const defaultTimeout = 30 * time.Second
+
+// Timeout puts a deadline on each request's context and answers 504 if the
+// handler hasn't finished by then. The deadline is looked up by the mux
+// pattern the request matched.
+//
+//	ROUTE_TIMEOUT   default deadline for every route (default 30s)
+//	ROUTE_TIMEOUTS  per-route overrides keyed by mux pattern,
+//	                e.g. "GET /users/all=2s,/txn/getall=10s"
+func Timeout(mux *http.ServeMux, next http.Handler) http.Handler {
+
+	fallback, perRoute := loadTimeouts()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		_, route := mux.Handler(r)
+
+		timeout, ok := perRoute[route]
+		if !ok {
+			timeout = fallback
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+
+		// A panic in the handler is handed back and re-raised here, so
+		// net/http recovers it for this connection as it would have
+		// without the extra goroutine.
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+
+		case <-done:
+			tw.flush(w)
+
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.expired = true
+
+			// The client hung up; nobody is left to answer.
+			if ctx.Err() == context.Canceled {
+				return
+			}
+
+			util.RespondWithError(w, http.StatusGatewayTimeout, "request timed out")
+		}
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// timeoutWriter buffers the handler's response so it can be dropped in
+// favour of a 504 if the deadline wins the race.
+type timeoutWriter struct {
+	mu      sync.Mutex
+	header  http.Header
+	buf     bytes.Buffer
+	status  int
+	expired bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 {
+		tw.status = code
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) flush(w http.ResponseWriter) {
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	for k, v := range tw.header {
+		w.Header()[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	w.WriteHeader(tw.status)
+	w.Write(tw.buf.Bytes())
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func loadTimeouts() (time.Duration, map[string]time.Duration) {
+
+	fallback := defaultTimeout
+
+	if v := os.Getenv("ROUTE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("invalid ROUTE_TIMEOUT:", err)
+		}
+		fallback = d
+	}
+
+	perRoute := map[string]time.Duration{}
+
+	for _, entry := range strings.Split(os.Getenv("ROUTE_TIMEOUTS"), ",") {
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Fatalf("invalid ROUTE_TIMEOUTS entry %q", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			log.Fatalf("invalid ROUTE_TIMEOUTS entry %q: %v", entry, err)
+		}
+
+		perRoute[strings.TrimSpace(route)] = d
+	}
+
+	return fallback, perRoute
+}
@@ -0,0 +1,38 @@
+package badger
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// gcDiscardRatio is how much of a value log file must be stale before GC
+// rewrites it.
+const gcDiscardRatio = 0.5
+
+// CollectGarbage rewrites value log files until none is worth rewriting,
+// or ctx ends, and returns how many it rewrote.
+func CollectGarbage(ctx context.Context) (int, error) {
+
+	rewritten := 0
+
+	for ctx.Err() == nil {
+
+		err := db.RunValueLogGC(gcDiscardRatio)
+
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return rewritten, nil
+		}
+		if err != nil {
+			return rewritten, err
+		}
+
+		rewritten++
+	}
+
+	return rewritten, ctx.Err()
+}
@@ -0,0 +1,37 @@
+package badger
+
+import (
+	"context"
+	"sync"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   []func(context.Context, Txn)
+)
+
+// OnTxnCreated registers fn to be called, in its own goroutine, with
+// every txn once it has been saved. The context keeps the creating
+// request's values but not its deadline.
+func OnTxnCreated(fn func(context.Context, Txn)) {
+
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	subscribers = append(subscribers, fn)
+}
+
+func notifyCreated(ctx context.Context, txn Txn) {
+
+	subscribersMu.RLock()
+	defer subscribersMu.RUnlock()
+
+	ctx = context.WithoutCancel(ctx)
+
+	for _, fn := range subscribers {
+		go fn(ctx, txn)
+	}
+}
@@ -0,0 +1,45 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// AppendLedger records an outbox event as a txn keyed by the event ID.
+// An event already in the ledger is left alone, so redelivery is safe.
+// It reports whether the event was new.
+func AppendLedger(ctx context.Context, ev *postgres.OutboxEvent) (bool, error) {
+
+	created := false
+
+	err := update(ctx, func(txn *badger.Txn) error {
+
+		_, err := txn.Get([]byte(ev.EventID))
+
+		if err == nil {
+			return nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		created = true
+
+		return txn.Set([]byte(ev.EventID), []byte(jsonString(Txn{
+			UUID:      ev.EventID,
+			Item:      ev.Type,
+			Code:      ev.AggregateID,
+			Timestamp: ev.CreatedAt.Unix(),
+		})))
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("failed to append to ledger: %v", err)
+	}
+
+	return created, nil
+}
@@ -1,6 +1,7 @@
 package badger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,6 +14,11 @@ import (
 	"github.com/dgraph-io/badger/v3"
 	"github.com/google/uuid"
 	"github.com/vrecan/death"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/i101dev/multimodal-db/metrics"
+	"github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/tracing"
 )
 
 // --------------------------------------------------------------------
@@ -40,6 +46,8 @@ const (
 	genesisData = "First Transaction from Genesis"
 )
 
+var db *badger.DB
+
 // --------------------------------------------------------------------
 // --------------------------------------------------------------------
 func CloseDB(db *badger.DB) {
@@ -53,19 +61,25 @@ func CloseDB(db *badger.DB) {
 		fmt.Println("BadgerDB gracefully shutdown")
 	})
 }
-func ConnectDB() *badger.DB {
+func ConnectDB() {
+
+	if db != nil {
+		return
+	}
 
 	opts := badger.DefaultOptions(dbPath)
 	opts.Logger = &NullLogger{}
-	db, err := badger.Open(opts)
+	d, err := badger.Open(opts)
 
 	if err != nil {
 		log.Fatal("Failed to open BadgerDB:", err)
 	}
 
-	go CloseDB(db)
+	db = d
+
+	metrics.RegisterBadger(db)
 
-	return db
+	go CloseDB(db)
 }
 
 func CreateTxn(r *http.Request) (*Txn, error) {
@@ -87,16 +101,19 @@ func CreateTxn(r *http.Request) (*Txn, error) {
 	requestBody.Timestamp = time.Now().Unix()
 
 	// -------------------------------------------------------------
-	db := ConnectDB()
-	defer db.Close()
-
-	if err := db.Update(func(txn *badger.Txn) error {
-		txn.Set([]byte(requestBody.UUID), []byte(jsonString(requestBody)))
-		return nil
+	if err := update(r.Context(), func(txn *badger.Txn) error {
+		return txn.Set([]byte(requestBody.UUID), []byte(jsonString(requestBody)))
 	}); err != nil {
 		return nil, fmt.Errorf("failed to save transaction: %v", err)
 	}
 
+	// Badger and Postgres can't commit together; the txn stands either way.
+	if err := postgres.RecordAudit(r.Context(), "txns", requestBody.UUID, "create", nil, requestBody); err != nil {
+		log.Println("Error auditing transaction", requestBody.UUID+":", err)
+	}
+
+	notifyCreated(r.Context(), requestBody)
+
 	return &requestBody, nil
 }
 
@@ -104,10 +121,7 @@ func GetAllTxns(r *http.Request) (*[]Txn, error) {
 
 	var allTxns []Txn
 
-	db := ConnectDB()
-	defer db.Close()
-
-	if err := db.View(func(txn *badger.Txn) error {
+	if err := view(r.Context(), func(txn *badger.Txn) error {
 
 		opts := badger.DefaultIteratorOptions
 		opts.Prefix = []byte("")
@@ -117,6 +131,12 @@ func GetAllTxns(r *http.Request) (*[]Txn, error) {
 		// -------------------------------------------------------------
 		for it.Rewind(); it.Valid(); it.Next() {
 
+			select {
+			case <-r.Context().Done():
+				return r.Context().Err()
+			default:
+			}
+
 			item := it.Item()
 			var txnData Txn
 
@@ -167,10 +187,7 @@ func GetRecentTxns(r *http.Request) (*[]Txn, error) {
 	currentTime := time.Now().Unix()
 	cutoffTime := currentTime - requestBody.Minutes*60
 
-	db := ConnectDB()
-	defer db.Close()
-
-	if err := db.View(func(txn *badger.Txn) error {
+	if err := view(r.Context(), func(txn *badger.Txn) error {
 
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
@@ -180,6 +197,12 @@ func GetRecentTxns(r *http.Request) (*[]Txn, error) {
 		// -------------------------------------------------------------
 		for it.Rewind(); it.Valid(); it.Next() {
 
+			select {
+			case <-r.Context().Done():
+				return r.Context().Err()
+			default:
+			}
+
 			item := it.Item()
 			var txnData Txn
 
@@ -215,6 +238,34 @@ func GetRecentTxns(r *http.Request) (*[]Txn, error) {
 	return &recentTxns, nil
 }
 
+// update and view wrap db.Update / db.View so every Badger transaction is
+// timed and traced under the request that issued it.
+func update(ctx context.Context, fn func(txn *badger.Txn) error) error {
+
+	_, span := tracing.Start(ctx, "badger.update", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+
+	err := db.Update(fn)
+
+	metrics.ObserveDB("badger", "update", start, err)
+	tracing.End(span, err)
+
+	return err
+}
+
+func view(ctx context.Context, fn func(txn *badger.Txn) error) error {
+
+	_, span := tracing.Start(ctx, "badger.view", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+
+	err := db.View(fn)
+
+	metrics.ObserveDB("badger", "view", start, err)
+	tracing.End(span, err)
+
+	return err
+}
+
 func jsonString(data interface{}) string {
 	str, _ := json.Marshal(data)
 	return string(str)
@@ -13,6 +13,8 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/google/uuid"
+	"github.com/i101dev/multimodal-db/metrics"
+	"github.com/i101dev/multimodal-db/tracing"
 	"github.com/i101dev/multimodal-db/util"
 )
 
@@ -76,6 +78,13 @@ func ConnectDB() {
 
 	db = d
 
+	if err := db.Use(metrics.GormPlugin{Store: "mysql"}); err != nil {
+		log.Fatal("Error registering metrics plugin:", err)
+	}
+	if err := db.Use(tracing.GormPlugin{System: "mysql"}); err != nil {
+		log.Fatal("Error registering tracing plugin:", err)
+	}
+
 	// ----------------------------------------------------
 	// Migrations -----------------------------------------
 	//
@@ -105,7 +114,7 @@ func CreateUser(r *http.Request) (*User, error) {
 	requestBody.UUID = uuid.New().String()
 	requestBody.Skills = []Skill{}
 
-	if result := db.Create(requestBody); result.Error != nil {
+	if result := db.WithContext(r.Context()).Create(requestBody); result.Error != nil {
 		return nil, result.Error
 	}
 
@@ -116,7 +125,7 @@ func GetAllUsers(r *http.Request) (*[]User, error) {
 
 	allUsers := []User{}
 
-	result := db.Find(&allUsers)
+	result := db.WithContext(r.Context()).Find(&allUsers)
 
 	if result.Error != nil {
 		return &allUsers, result.Error
@@ -160,7 +169,7 @@ func UpdateUser(r *http.Request) (*User, error) {
 	}
 	// ----------------------------------------------
 
-	if err := db.Save(userData).Error; err != nil {
+	if err := db.WithContext(r.Context()).Save(userData).Error; err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
 
@@ -175,7 +184,7 @@ func DeleteUser(r *http.Request) error {
 		return err
 	}
 
-	if err := db.Delete(userData).Error; err != nil {
+	if err := db.WithContext(r.Context()).Delete(userData).Error; err != nil {
 		return fmt.Errorf("error deleting user: %w", err)
 	}
 
@@ -199,7 +208,7 @@ func userData_byUUID(r *http.Request) (*User, *User, error) {
 
 	userData := &User{}
 
-	if err := db.Where("uuid = ?", reqBody.UUID).First(userData).Error; err != nil {
+	if err := db.WithContext(r.Context()).Where("uuid = ?", reqBody.UUID).First(userData).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return &reqBody, nil, fmt.Errorf("user not found")
 		}
@@ -223,7 +232,7 @@ func userData_byName(r *http.Request) (*User, *User, error) {
 
 	userData := &User{}
 
-	if err := db.Where("name = ?", reqBody.Name).First(userData).Error; err != nil {
+	if err := db.WithContext(r.Context()).Where("name = ?", reqBody.Name).First(userData).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return &reqBody, nil, fmt.Errorf("user not found")
 		}
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const APIKeyPrefix = "mmdb_"
+
+// LastUsedAt is only kept to the minute, so a busy key costs one write a
+// minute rather than one per request.
+const lastUsedResolution = time.Minute
+
+var ErrAPIKeyNotFound = errors.New("key not found")
+
+// APIKey is a bearer credential. Only the SHA-256 of the key is stored;
+// the plaintext is returned once, when the key is minted.
+type APIKey struct {
+	gorm.Model
+	UUID       string     `json:"uuid"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     Scopes     `gorm:"type:jsonb" json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Scopes) Scan(src interface{}) error {
+	if b, ok := src.([]byte); ok {
+		return json.Unmarshal(b, s)
+	}
+	return errors.New("unsupported data type for scanning into Scopes")
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// CreateAPIKey mints a key with the requested scopes, each of which must
+// appear in allowed. The plaintext key is returned alongside the record.
+func CreateAPIKey(r *http.Request, allowed []string) (*APIKey, string, error) {
+
+	var reqBody struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	// ----------------------------------------------------------------------------
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, "", err
+	}
+	if reqBody.Name == "" {
+		return nil, "", fmt.Errorf("invalid [name]")
+	}
+	if len(reqBody.Scopes) == 0 {
+		return nil, "", fmt.Errorf("invalid [scopes]")
+	}
+	for _, scope := range reqBody.Scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, "", fmt.Errorf("invalid scope [%s]", scope)
+		}
+	}
+
+	// ----------------------------------------------------------------------------
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("error generating key: %w", err)
+	}
+
+	plaintext := APIKeyPrefix + hex.EncodeToString(secret)
+
+	newKey := &APIKey{
+		UUID:   uuid.New().String(),
+		Name:   reqBody.Name,
+		Prefix: plaintext[:len(APIKeyPrefix)+8],
+		Hash:   HashAPIKey(plaintext),
+		Scopes: reqBody.Scopes,
+	}
+
+	if err := db.WithContext(r.Context()).Create(newKey).Error; err != nil {
+		return nil, "", fmt.Errorf("error saving key: %w", err)
+	}
+
+	return newKey, plaintext, nil
+}
+
+func GetAllAPIKeys(r *http.Request) (*[]APIKey, error) {
+
+	allKeys := []APIKey{}
+
+	if err := db.WithContext(r.Context()).Order("id").Find(&allKeys).Error; err != nil {
+		return &allKeys, err
+	}
+
+	return &allKeys, nil
+}
+
+func RevokeAPIKey(r *http.Request) (*APIKey, error) {
+
+	var reqBody struct {
+		UUID string `json:"uuid"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if reqBody.UUID == "" {
+		return nil, fmt.Errorf("invalid [uuid]")
+	}
+
+	// ----------------------------------------------------------------------------
+	keyDat := &APIKey{}
+	if err := db.WithContext(r.Context()).Where("uuid = ?", reqBody.UUID).First(keyDat).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("key not found")
+		}
+		return nil, fmt.Errorf("error retrieving key: %w", err)
+	}
+
+	if keyDat.RevokedAt != nil {
+		return keyDat, nil
+	}
+
+	now := time.Now()
+	keyDat.RevokedAt = &now
+
+	if err := db.WithContext(r.Context()).Save(keyDat).Error; err != nil {
+		return nil, fmt.Errorf("error revoking key: %w", err)
+	}
+
+	return keyDat, nil
+}
+
+// FindActiveAPIKey resolves a presented plaintext key to its record. Unknown
+// and revoked keys are both reported as not found.
+func FindActiveAPIKey(ctx context.Context, plaintext string) (*APIKey, error) {
+
+	keyDat := &APIKey{}
+
+	err := db.WithContext(ctx).
+		Where("hash = ? AND revoked_at IS NULL", HashAPIKey(plaintext)).
+		First(keyDat).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error retrieving key: %w", err)
+	}
+
+	now := time.Now()
+	if keyDat.LastUsedAt != nil && now.Sub(*keyDat.LastUsedAt) < lastUsedResolution {
+		return keyDat, nil
+	}
+
+	// Another instance may have got there first; the condition makes that
+	// a no-op.
+	err = db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", keyDat.ID, now.Add(-lastUsedResolution)).
+		UpdateColumn("last_used_at", now).Error
+	if err != nil {
+		log.Println("Error recording use of key", keyDat.UUID+":", err)
+		return keyDat, nil
+	}
+	keyDat.LastUsedAt = &now
+
+	return keyDat, nil
+}
+
+func HashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
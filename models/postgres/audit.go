@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry records one mutation of one entity in any store. Entries are
+// only ever appended.
+type AuditEntry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"timestamp"`
+	Entity    string    `gorm:"index:idx_audit_entity" json:"entity"`
+	EntityID  string    `gorm:"index:idx_audit_entity" json:"entity_id"`
+	Action    string    `json:"action"`
+	Actor     string    `gorm:"index" json:"actor"`
+	RequestID string    `json:"request_id"`
+	Changes   AuditDiff `gorm:"type:jsonb" json:"changes"`
+}
+
+// AuditDiff maps each field a mutation touched to its old and new value.
+type AuditDiff map[string]FieldChange
+
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+func (d AuditDiff) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+func (d *AuditDiff) Scan(src interface{}) error {
+	if b, ok := src.([]byte); ok {
+		return json.Unmarshal(b, d)
+	}
+	return errors.New("unsupported data type for scanning into AuditDiff")
+}
+
+type actorKey struct{}
+
+// WithActor names who is responsible for mutations made under ctx, as
+// "kind:id". Work done outside any request is attributed to "system".
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns who WithActor named for ctx.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "system"
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// RecordAudit appends an entry for a mutation made outside Postgres.
+// before is nil for creates and after is nil for deletes.
+func RecordAudit(ctx context.Context, entity, entityID, action string, before, after interface{}) error {
+	return appendAudit(db.WithContext(ctx), entity, entityID, action, diffOf(before, after))
+}
+
+// GetAuditLog returns entries newest first, filtered by the entity,
+// entity_id, actor, action, since and until (RFC 3339) query parameters.
+func GetAuditLog(r *http.Request) (*[]AuditEntry, error) {
+
+	query := r.URL.Query()
+	tx := db.WithContext(r.Context())
+
+	for param, column := range map[string]string{
+		"entity":    "entity",
+		"entity_id": "entity_id",
+		"actor":     "actor",
+		"action":    "action",
+	} {
+		if value := query.Get(param); value != "" {
+			tx = tx.Where(column+" = ?", value)
+		}
+	}
+
+	// ----------------------------------------------------------------------------
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid [since]")
+		}
+		tx = tx.Where("created_at >= ?", t)
+	}
+	if until := query.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid [until]")
+		}
+		tx = tx.Where("created_at < ?", t)
+	}
+
+	limit := defaultAuditLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return nil, fmt.Errorf("invalid [limit]: must be 1-%d", maxAuditLimit)
+		}
+		limit = n
+	}
+
+	// ----------------------------------------------------------------------------
+	entries := []AuditEntry{}
+
+	if err := tx.Order("created_at DESC, id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return &entries, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// appendAudit writes an entry through tx, so a user mutation and its
+// audit entry commit or roll back together.
+func appendAudit(tx *gorm.DB, entity, entityID, action string, changes AuditDiff) error {
+
+	ctx := tx.Statement.Context
+
+	entry := &AuditEntry{
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Actor:     Actor(ctx),
+		RequestID: util.RequestID(ctx),
+		Changes:   changes,
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("error recording audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// diffOf compares the JSON forms of before and after field by field.
+// Fields hidden from JSON, such as password hashes, never appear.
+func diffOf(before, after interface{}) AuditDiff {
+
+	from, to := fieldsOf(before), fieldsOf(after)
+	diff := AuditDiff{}
+
+	for field, value := range from {
+		if !reflect.DeepEqual(value, to[field]) {
+			diff[field] = FieldChange{From: value, To: to[field]}
+		}
+	}
+	for field, value := range to {
+		if _, seen := from[field]; !seen && value != nil {
+			diff[field] = FieldChange{To: value}
+		}
+	}
+
+	// Bookkeeping that changes on every write says nothing on its own.
+	delete(diff, "UpdatedAt")
+
+	return diff
+}
+
+func fieldsOf(v interface{}) map[string]interface{} {
+
+	fields := map[string]interface{}{}
+
+	if v == nil {
+		return fields
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return fields
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+
+	json.Unmarshal(data, &fields)
+
+	return fields
+}
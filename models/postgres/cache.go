@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/metrics"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// UserCache sits in front of user lookups by UUID and by name. Every
+// committed change to a user invalidates it, by its old and new name.
+type UserCache interface {
+	Get(ctx context.Context, column, value string) (*User, bool)
+	Set(ctx context.Context, u *User)
+	Invalidate(ctx context.Context, users ...*User)
+}
+
+var (
+	userCache   UserCache
+	userLookups singleflight.Group
+)
+
+// SetUserCache puts cache in front of user lookups. Call it before
+// serving.
+func SetUserCache(cache UserCache) {
+	userCache = cache
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// cachedUser looks a live user up by column ("uuid" or "name") through
+// the cache, if there is one. Concurrent misses for the same user share
+// a single query.
+func cachedUser(ctx context.Context, column, value string) (*User, error) {
+
+	if userCache == nil {
+		return findUser(ctx, column, value)
+	}
+
+	if u, ok := userCache.Get(ctx, column, value); ok {
+		metrics.ObserveCache("users", true)
+		return u, nil
+	}
+	metrics.ObserveCache("users", false)
+
+	// The query is shared, so one caller giving up mustn't fail the rest.
+	v, err, _ := userLookups.Do(column+":"+value, func() (interface{}, error) {
+
+		u, err := findUser(context.WithoutCancel(ctx), column, value)
+		if err != nil {
+			return nil, err
+		}
+
+		userCache.Set(context.WithoutCancel(ctx), u)
+
+		return u, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each caller gets its own copy of the shared result.
+	u := *v.(*User)
+	u.Skills = slices.Clone(u.Skills)
+
+	return &u, nil
+}
+
+func findUser(ctx context.Context, column, value string) (*User, error) {
+
+	userData := &User{}
+
+	if err := db.WithContext(ctx).Where(column+" = ?", value).First(userData).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	return userData, nil
+}
+
+// invalidateUsers drops users from the cache once the change to them has
+// committed.
+func invalidateUsers(ctx context.Context, users ...*User) {
+	if userCache != nil {
+		userCache.Invalidate(context.WithoutCancel(ctx), users...)
+	}
+}
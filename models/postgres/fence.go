@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/leader"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// LockFence is the highest fencing token a write has been accepted under,
+// per lock.
+type LockFence struct {
+	Name  string `gorm:"primarykey" json:"name"`
+	Token int64  `json:"token"`
+}
+
+// checkFence admits tx's writes under fence, or fails with
+// leader.ErrStaleFence if a later holder of the lock has already written.
+// The fence's row stays locked until tx ends, so an old and a new holder
+// can't interleave.
+func checkFence(tx *gorm.DB, fence leader.Fence) error {
+
+	if fence.Token == 0 {
+		return nil
+	}
+
+	result := tx.Exec(`
+		INSERT INTO lock_fences (name, token) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET token = EXCLUDED.token
+		WHERE lock_fences.token <= EXCLUDED.token`, fence.Lock, fence.Token)
+
+	if result.Error != nil {
+		return fmt.Errorf("error checking fence: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return leader.ErrStaleFence
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/i101dev/multimodal-db/leader"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it describes, so the event exists if and only if the change
+// does. The relay publishes it to the other stores afterwards.
+type OutboxEvent struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EventID     string     `gorm:"uniqueIndex" json:"event_id"`
+	Type        string     `json:"type"`
+	AggregateID string     `json:"aggregate_id"`
+	Payload     string     `gorm:"type:jsonb" json:"payload"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// ProcessOutbox hands up to limit unpublished events to publish, oldest
+// first, and marks each one published once publish returns nil. Events
+// are locked with SKIP LOCKED, so several relays can run at once without
+// publishing the same event concurrently.
+//
+// Delivery is at least once: if the process dies between publish and the
+// commit, the event goes out again, so publish must dedup by EventID.
+func ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, *OutboxEvent) error) (int, error) {
+
+	published := 0
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var events []OutboxEvent
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Order("id").
+			Limit(limit).
+			Find(&events).Error; err != nil {
+			return err
+		}
+
+		for i := range events {
+
+			ev := &events[i]
+
+			// Stop at the first failure so later events don't overtake it.
+			if err := publish(ctx, ev); err != nil {
+				return tx.Model(ev).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": err.Error(),
+				}).Error
+			}
+
+			if err := tx.Model(ev).Update("published_at", time.Now()).Error; err != nil {
+				return err
+			}
+			published++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return published, fmt.Errorf("error processing outbox: %w", err)
+	}
+
+	return published, nil
+}
+
+// PruneOutbox deletes events published before cutoff, unless fence has
+// been superseded.
+func PruneOutbox(ctx context.Context, cutoff time.Time, fence leader.Fence) (int64, error) {
+
+	var pruned int64
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := checkFence(tx, fence); err != nil {
+			return err
+		}
+
+		result := tx.Where("published_at < ?", cutoff).Delete(&OutboxEvent{})
+		pruned = result.RowsAffected
+
+		return result.Error
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("error pruning outbox: %w", err)
+	}
+
+	return pruned, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func appendOutbox(tx *gorm.DB, eventType, aggregateID string, payload interface{}) error {
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ev := &OutboxEvent{
+		EventID:     uuid.New().String(),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     string(data),
+	}
+
+	if err := tx.Create(ev).Error; err != nil {
+		return fmt.Errorf("error recording outbox event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// argon2id parameters, per the RFC 9106 "second recommended" profile.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+
+	minPasswordLen = 8
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// VerifyCredentials returns the user with this name if password matches.
+// Unknown names and wrong passwords are indistinguishable to the caller.
+func VerifyCredentials(ctx context.Context, name, password string) (*User, error) {
+
+	userDat := &User{}
+
+	if err := db.WithContext(ctx).Where("name = ?", name).First(userDat).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// Burn the same time a real comparison would.
+			hashPassword(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	if !checkPassword(userDat.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return userDat, nil
+}
+
+// SetPassword changes a user's password. A user changing their own
+// password must also present the current one.
+func SetPassword(r *http.Request) error {
+
+	var reqBody struct {
+		UUID            string `json:"uuid"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	// ----------------------------------------------------------------------------
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return err
+	}
+	if reqBody.UUID == "" {
+		return fmt.Errorf("invalid [uuid]")
+	}
+	if len(reqBody.Password) < minPasswordLen {
+		return fmt.Errorf("invalid [password]: must be at least %d characters", minPasswordLen)
+	}
+	if err := checkActingUser(r.Context(), reqBody.UUID); err != nil {
+		return err
+	}
+
+	// ----------------------------------------------------------------------------
+	userDat := &User{}
+	if err := db.WithContext(r.Context()).Where("uuid = ?", reqBody.UUID).First(userDat).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	if _, self := ActingUser(r.Context()); self && !checkPassword(userDat.PasswordHash, reqBody.CurrentPassword) {
+		return ErrInvalidCredentials
+	}
+
+	// ----------------------------------------------------------------------------
+	// The hash is never shown, so the entry only says the password changed.
+	err := db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Model(userDat).Update("password_hash", hashPassword(reqBody.Password)).Error; err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+
+		return appendAudit(tx, "users", userDat.UUID, "update", AuditDiff{
+			"password": {From: "[redacted]", To: "[redacted]"},
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	invalidateUsers(r.Context(), userDat)
+
+	return nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Hashes are stored in the PHC string format so the parameters can be
+// raised later without invalidating existing hashes.
+func hashPassword(password string) string {
+
+	salt := make([]byte, argonSaltLen)
+	rand.Read(salt)
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func checkPassword(encoded, password string) bool {
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
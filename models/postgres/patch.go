@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/google/uuid"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	ErrUnsupportedPatch = errors.New("patch must be application/merge-patch+json or application/json-patch+json")
+	ErrInvalidPatch     = errors.New("invalid patch")
+)
+
+// patchableUser is the part of a User a patch may touch. Identity,
+// version and timestamps are not patchable; a patch naming them fails
+// validation rather than being silently ignored.
+type patchableUser struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Skills   Skills `json:"skills"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// PatchUser applies an RFC 7396 merge patch or RFC 6902 JSON Patch, chosen
+// by Content-Type, to the user named in the path. The patched document is
+// validated as a whole before anything is written.
+func PatchUser(r *http.Request) (*User, error) {
+
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+
+	userUUID := r.PathValue("uuid")
+	if err := checkActingUser(r.Context(), userUUID); err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json-patch+json" {
+		return nil, ErrUnsupportedPatch
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// ----------------------------------------------------------------------------
+	// Read past the cache: the patch has to apply to the current document.
+	current, err := findUser(r.Context(), "uuid", userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The patch was computed against what the client last saw; with "*"
+	// that's whatever we just read. Either way it must apply to exactly
+	// the version it was computed against.
+	if !match.accepts(current.Version) {
+		return nil, ErrVersionMismatch
+	}
+	match = ifMatch{current.Version}
+
+	doc, err := json.Marshal(patchableUser{
+		Name:     current.Name,
+		Location: current.Location,
+		Skills:   current.Skills,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ----------------------------------------------------------------------------
+	var patched []byte
+
+	if mediaType == "application/merge-patch+json" {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = ops.Apply(doc)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	// ----------------------------------------------------------------------------
+	result, err := validatePatchedUser(patched)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	if result.Name != current.Name {
+		taken := &User{}
+		if err := db.WithContext(r.Context()).Where("name = ?", result.Name).First(taken).Error; err == nil {
+			return nil, ErrNameConflict
+		}
+	}
+
+	return updateVersioned(r.Context(), userUUID, match, map[string]interface{}{
+		"name":     result.Name,
+		"location": result.Location,
+		"skills":   result.Skills,
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func validatePatchedUser(patched []byte) (*patchableUser, error) {
+
+	var result patchableUser
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.Name == "" {
+		return nil, fmt.Errorf("[name] may not be empty")
+	}
+	if result.Skills == nil {
+		result.Skills = Skills{}
+	}
+
+	seen := map[string]bool{}
+
+	for i := range result.Skills {
+
+		skill := &result.Skills[i]
+
+		if skill.Type == "" {
+			return nil, fmt.Errorf("skills[%d]: invalid [type]", i)
+		}
+		if skill.Level < 1 {
+			return nil, fmt.Errorf("skills[%d]: invalid [level]", i)
+		}
+
+		// Skills added by the patch get an identity like AddSkill's do.
+		if skill.UUID == "" {
+			skill.UUID = uuid.New().String()
+		}
+		if seen[skill.UUID] {
+			return nil, fmt.Errorf("skills[%d]: duplicate [uuid]", i)
+		}
+		seen[skill.UUID] = true
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Policy grants a role one action on one resource. "*" matches any
+// resource or action.
+type Policy struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	Role     string `gorm:"uniqueIndex:idx_policy" json:"role"`
+	Resource string `gorm:"uniqueIndex:idx_policy" json:"resource"`
+	Action   string `gorm:"uniqueIndex:idx_policy" json:"action"`
+}
+
+// RoleBinding assigns a role to a principal: an API key or a user,
+// identified by kind and UUID.
+type RoleBinding struct {
+	ID            uint   `gorm:"primarykey" json:"id"`
+	PrincipalKind string `gorm:"uniqueIndex:idx_binding" json:"principal_kind"`
+	PrincipalID   string `gorm:"uniqueIndex:idx_binding" json:"principal_id"`
+	Role          string `json:"role"`
+}
+
+// Seeded into an empty policy table on first start.
+var defaultPolicies = []Policy{
+	{Role: "admin", Resource: "*", Action: "*"},
+
+	{Role: "operator", Resource: "*", Action: "read"},
+	{Role: "operator", Resource: "alerts", Action: "create"},
+	{Role: "operator", Resource: "alerts", Action: "update"},
+	{Role: "operator", Resource: "txns", Action: "create"},
+
+	{Role: "viewer", Resource: "*", Action: "read"},
+}
+
+func seedPolicies() error {
+
+	var count int64
+	if err := db.Model(&Policy{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return db.Create(&defaultPolicies).Error
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func LoadPolicies(ctx context.Context) ([]Policy, error) {
+
+	policies := []Policy{}
+
+	if err := db.WithContext(ctx).Order("role, resource, action").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("error loading policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+func LoadRoleBindings(ctx context.Context) ([]RoleBinding, error) {
+
+	bindings := []RoleBinding{}
+
+	if err := db.WithContext(ctx).Order("principal_kind, principal_id").Find(&bindings).Error; err != nil {
+		return nil, fmt.Errorf("error loading role bindings: %w", err)
+	}
+
+	return bindings, nil
+}
+
+func GrantPolicy(r *http.Request, roles []string) (*Policy, error) {
+
+	var reqBody Policy
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if err := validateRole(reqBody.Role, roles); err != nil {
+		return nil, err
+	}
+	if reqBody.Resource == "" {
+		return nil, fmt.Errorf("invalid [resource]")
+	}
+	if reqBody.Action == "" {
+		return nil, fmt.Errorf("invalid [action]")
+	}
+
+	newPolicy := &Policy{Role: reqBody.Role, Resource: reqBody.Resource, Action: reqBody.Action}
+
+	err := db.WithContext(r.Context()).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(newPolicy).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("error saving policy: %w", err)
+	}
+
+	return newPolicy, nil
+}
+
+func RevokePolicy(r *http.Request) error {
+
+	var reqBody Policy
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return err
+	}
+
+	result := db.WithContext(r.Context()).
+		Where("role = ? AND resource = ? AND action = ?", reqBody.Role, reqBody.Resource, reqBody.Action).
+		Delete(&Policy{})
+
+	if result.Error != nil {
+		return fmt.Errorf("error deleting policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("policy not found")
+	}
+
+	return nil
+}
+
+// AssignRole binds a principal to a role, replacing any role it had.
+func AssignRole(r *http.Request, roles []string) (*RoleBinding, error) {
+
+	var reqBody RoleBinding
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if reqBody.PrincipalKind != "apikey" && reqBody.PrincipalKind != "user" {
+		return nil, fmt.Errorf("invalid [principal_kind]")
+	}
+	if reqBody.PrincipalID == "" {
+		return nil, fmt.Errorf("invalid [principal_id]")
+	}
+	if err := validateRole(reqBody.Role, roles); err != nil {
+		return nil, err
+	}
+
+	binding := &RoleBinding{
+		PrincipalKind: reqBody.PrincipalKind,
+		PrincipalID:   reqBody.PrincipalID,
+		Role:          reqBody.Role,
+	}
+
+	err := db.WithContext(r.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "principal_kind"}, {Name: "principal_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(binding).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("error saving role binding: %w", err)
+	}
+
+	return binding, nil
+}
+
+func UnassignRole(r *http.Request) error {
+
+	var reqBody RoleBinding
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return err
+	}
+
+	result := db.WithContext(r.Context()).
+		Where("principal_kind = ? AND principal_id = ?", reqBody.PrincipalKind, reqBody.PrincipalID).
+		Delete(&RoleBinding{})
+
+	if result.Error != nil {
+		return fmt.Errorf("error deleting role binding: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("role binding not found")
+	}
+
+	return nil
+}
+
+func validateRole(role string, roles []string) error {
+	if !slices.Contains(roles, role) {
+		return fmt.Errorf("invalid [role]")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// UserRevision is a full snapshot of a user as a mutation left it. A
+// user's revisions, ordered by time, are its complete history; a deleted
+// revision marks the stretch during which the user was soft-deleted.
+type UserRevision struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_revision_user,priority:2" json:"timestamp"`
+	UserUUID  string    `gorm:"index:idx_revision_user,priority:1" json:"user_uuid"`
+	Version   int       `json:"version"`
+	Action    string    `json:"action"`
+	Deleted   bool      `json:"deleted"`
+	Name      string    `json:"name"`
+	Location  string    `json:"location"`
+	Skills    Skills    `gorm:"type:jsonb" json:"skills"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// GetUser reads a user by the UUID in the path. With ?as_of= (RFC 3339 or
+// unix seconds) it returns the user as they stood at that moment instead.
+func GetUser(r *http.Request) (*User, error) {
+
+	userUUID := r.PathValue("uuid")
+
+	asOf := r.URL.Query().Get("as_of")
+	if asOf == "" {
+		return GetUserByUUID(r.Context(), userUUID)
+	}
+
+	at, err := parseAsOf(asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// ----------------------------------------------------------------------------
+	rev := &UserRevision{}
+
+	err = db.WithContext(r.Context()).
+		Where("user_uuid = ? AND created_at <= ?", userUUID, at).
+		Order("created_at DESC, id DESC").
+		First(rev).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving revision: %w", err)
+	}
+	if rev.Deleted {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return rev.user(), nil
+}
+
+// GetUserRevisions lists a user's revisions, oldest first. They outlive a
+// soft delete but not a purge.
+func GetUserRevisions(r *http.Request) (*[]UserRevision, error) {
+
+	userUUID := r.PathValue("uuid")
+
+	revisions := []UserRevision{}
+
+	result := db.WithContext(r.Context()).
+		Where("user_uuid = ?", userUUID).
+		Order("created_at, id").
+		Find(&revisions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("error retrieving revisions: %w", result.Error)
+	}
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return &revisions, nil
+}
+
+// RevertUser sets a user's fields back to those of one of their earlier
+// revisions. The revert is itself a new revision, so it can be undone the
+// same way.
+func RevertUser(r *http.Request) (*User, error) {
+
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+
+	userUUID := r.PathValue("uuid")
+	if err := checkActingUser(r.Context(), userUUID); err != nil {
+		return nil, err
+	}
+
+	var reqBody struct {
+		RevisionID uint `json:"revision_id"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if reqBody.RevisionID == 0 {
+		return nil, fmt.Errorf("invalid [revision_id]")
+	}
+
+	// ----------------------------------------------------------------------------
+	rev := &UserRevision{}
+
+	err = db.WithContext(r.Context()).
+		Where("id = ? AND user_uuid = ?", reqBody.RevisionID, userUUID).
+		First(rev).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("revision not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving revision: %w", err)
+	}
+	if rev.Deleted {
+		return nil, fmt.Errorf("cannot revert to a deleted revision; restore the user instead")
+	}
+
+	return updateVersioned(r.Context(), userUUID, match, map[string]interface{}{
+		"name":     rev.Name,
+		"location": rev.Location,
+		"skills":   rev.Skills,
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// appendRevision snapshots a user through tx, alongside the write that
+// produced this state.
+func appendRevision(tx *gorm.DB, u *User, action string, deleted bool) error {
+
+	rev := &UserRevision{
+		UserUUID: u.UUID,
+		Version:  u.Version,
+		Action:   action,
+		Deleted:  deleted,
+		Name:     u.Name,
+		Location: u.Location,
+		Skills:   u.Skills,
+	}
+
+	if err := tx.Create(rev).Error; err != nil {
+		return fmt.Errorf("error recording revision: %w", err)
+	}
+
+	return nil
+}
+
+// backfillRevisions gives users created before revisions were kept a
+// first revision, dated to their last update, so as_of reads can find
+// them.
+func backfillRevisions() error {
+
+	return db.Exec(`
+		INSERT INTO user_revisions (created_at, user_uuid, version, action, deleted, name, location, skills)
+		SELECT updated_at, uuid, version, 'backfill', deleted_at IS NOT NULL, name, location, skills
+		FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM user_revisions r WHERE r.user_uuid = u.uuid)
+	`).Error
+}
+
+func (rev *UserRevision) user() *User {
+
+	u := &User{
+		UUID:     rev.UserUUID,
+		Name:     rev.Name,
+		Location: rev.Location,
+		Skills:   rev.Skills,
+		Version:  rev.Version,
+	}
+	u.UpdatedAt = rev.CreatedAt
+
+	return u
+}
+
+func parseAsOf(value string) (time.Time, error) {
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid [as_of]: use RFC 3339 or unix seconds")
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// AlertRule raises an alert from txns. Code and Item are glob patterns
+// (empty matches anything). With a Threshold, the rule fires when more
+// than Threshold matching txns arrive within Window; without one it fires
+// on every match.
+type AlertRule struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UUID      string    `gorm:"uniqueIndex" json:"uuid"`
+	Name      string    `gorm:"uniqueIndex" json:"name"`
+	Title     string    `json:"title"`
+	Code      string    `json:"code"`
+	Item      string    `json:"item"`
+	Threshold int       `json:"threshold"`
+	Window    string    `json:"window"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func LoadAlertRules(ctx context.Context) ([]AlertRule, error) {
+
+	rules := []AlertRule{}
+
+	if err := db.WithContext(ctx).Order("name").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("error loading alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func CreateAlertRule(r *http.Request) (*AlertRule, error) {
+
+	var reqBody AlertRule
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+
+	// ----------------------------------------------
+	//
+	if reqBody.Name == "" {
+		return nil, fmt.Errorf("invalid [name]")
+	}
+	if reqBody.Code == "" && reqBody.Item == "" {
+		return nil, fmt.Errorf("rule must match on [code] or [item]")
+	}
+	for _, pattern := range []string{reqBody.Code, reqBody.Item} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern [%s]", pattern)
+		}
+	}
+	if reqBody.Threshold < 0 {
+		return nil, fmt.Errorf("invalid [threshold]")
+	}
+	if reqBody.Threshold > 0 {
+		if d, err := time.ParseDuration(reqBody.Window); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid [window]: a threshold needs a duration such as \"5m\"")
+		}
+	} else {
+		reqBody.Window = ""
+	}
+	//
+	// ----------------------------------------------
+
+	newRule := &AlertRule{
+		UUID:      uuid.New().String(),
+		Name:      reqBody.Name,
+		Title:     reqBody.Title,
+		Code:      reqBody.Code,
+		Item:      reqBody.Item,
+		Threshold: reqBody.Threshold,
+		Window:    reqBody.Window,
+	}
+
+	if err := db.WithContext(r.Context()).Create(newRule).Error; err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrNameConflict
+		}
+		return nil, fmt.Errorf("error saving alert rule: %w", err)
+	}
+
+	return newRule, nil
+}
+
+func DeleteAlertRule(r *http.Request) error {
+
+	var reqBody struct {
+		UUID string `json:"uuid"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return err
+	}
+
+	result := db.WithContext(r.Context()).Where("uuid = ?", reqBody.UUID).Delete(&AlertRule{})
+
+	if result.Error != nil {
+		return fmt.Errorf("error deleting alert rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alert rule not found")
+	}
+
+	return nil
+}
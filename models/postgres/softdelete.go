@@ -0,0 +1,261 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/i101dev/multimodal-db/leader"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var ErrNameConflict = errors.New("name already in play")
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// GetDeletedUsers lists soft-deleted users, most recently deleted first.
+func GetDeletedUsers(r *http.Request) (*[]User, error) {
+
+	deleted := []User{}
+
+	result := db.WithContext(r.Context()).Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&deleted)
+
+	if result.Error != nil {
+		return &deleted, result.Error
+	}
+
+	return &deleted, nil
+}
+
+// RestoreUser undoes a soft delete. Names are only unique among live
+// users, so if someone has since taken the name the restore is refused
+// unless the body supplies a new one.
+func RestoreUser(r *http.Request) (*User, error) {
+
+	if _, ok := ActingUser(r.Context()); ok {
+		return nil, ErrForbidden
+	}
+
+	var reqBody struct {
+		UUID string `json:"uuid"`
+		Name string `json:"name"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return nil, err
+	}
+	if reqBody.UUID == "" {
+		return nil, fmt.Errorf("invalid user [UUID]")
+	}
+
+	// ----------------------------------------------------------------------------
+	deleted := &User{}
+
+	err := db.WithContext(r.Context()).Unscoped().
+		Where("uuid = ? AND deleted_at IS NOT NULL", reqBody.UUID).
+		First(deleted).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("deleted user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	name := deleted.Name
+	if reqBody.Name != "" {
+		name = reqBody.Name
+	}
+
+	taken := &User{}
+	if err := db.WithContext(r.Context()).Where("name = ?", name).First(taken).Error; err == nil {
+		return nil, fmt.Errorf("%w: restore with a new [name]", ErrNameConflict)
+	}
+
+	// ----------------------------------------------------------------------------
+	userDat := &User{}
+
+	err = db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Unscoped().Model(userDat).Clauses(clause.Returning{}).
+			Where("uuid = ? AND deleted_at IS NOT NULL", reqBody.UUID).
+			Updates(map[string]interface{}{
+				"deleted_at": nil,
+				"name":       name,
+				"version":    gorm.Expr("version + 1"),
+			})
+
+		// Someone may have taken the name between the check and the update.
+		if isUniqueViolation(result.Error) {
+			return fmt.Errorf("%w: restore with a new [name]", ErrNameConflict)
+		}
+		if result.Error != nil {
+			return fmt.Errorf("error restoring user: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("deleted user not found")
+		}
+		if err := appendRevision(tx, userDat, "restore", false); err != nil {
+			return err
+		}
+		if err := appendOutbox(tx, "user.restored", userDat.UUID, userDat); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, "users", reqBody.UUID, "restore", diffOf(deleted, userDat))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateUsers(r.Context(), deleted, userDat)
+
+	return userDat, nil
+}
+
+// PurgeUser permanently removes a soft-deleted user along with their role
+// binding and revision history. Live users have to be deleted first.
+func PurgeUser(r *http.Request) error {
+
+	if _, ok := ActingUser(r.Context()); ok {
+		return ErrForbidden
+	}
+
+	var reqBody struct {
+		UUID string `json:"uuid"`
+	}
+
+	if err := util.ParseBody(r, &reqBody); err != nil {
+		return err
+	}
+	if reqBody.UUID == "" {
+		return fmt.Errorf("invalid user [UUID]")
+	}
+
+	purged, err := purgeUsers(r.Context(), db.Where("uuid = ?", reqBody.UUID), leader.Fence{})
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return fmt.Errorf("deleted user not found")
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently removes users soft-deleted before cutoff,
+// unless fence has been superseded. The user-purge job runs it on a
+// schedule.
+func PurgeDeletedUsers(ctx context.Context, cutoff time.Time, fence leader.Fence) (int64, error) {
+	return purgeUsers(ctx, db.Where("deleted_at < ?", cutoff), fence)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Keep each audited field's name but not its values.
+const redactedChanges = `(
+	SELECT COALESCE(jsonb_object_agg(key, '{"from": "[redacted]", "to": "[redacted]"}'::jsonb), '{}'::jsonb)
+	FROM jsonb_each(changes)
+)`
+
+const redactedPayload = `jsonb_build_object('uuid', aggregate_id, 'redacted', true)`
+
+// purgeUsers hard-deletes the soft-deleted users matching cond, their role
+// bindings and their revisions, in one transaction. Their audit entries
+// and outbox events stay, redacted: audit entries keep which fields
+// changed but not the values, and event payloads shrink to the user's
+// UUID. Events relayed before the purge keep their payloads in the Redis
+// event stream until its length cap trims them.
+func purgeUsers(ctx context.Context, cond *gorm.DB, fence leader.Fence) (int64, error) {
+
+	var purged int64
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := checkFence(tx, fence); err != nil {
+			return err
+		}
+
+		var uuids []string
+
+		if err := tx.Unscoped().Model(&User{}).
+			Where("deleted_at IS NOT NULL").Where(cond).
+			Pluck("uuid", &uuids).Error; err != nil {
+			return err
+		}
+		if len(uuids) == 0 {
+			return nil
+		}
+
+		if err := tx.Where("principal_kind = ? AND principal_id IN ?", "user", uuids).
+			Delete(&RoleBinding{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_uuid IN ?", uuids).Delete(&UserRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&AuditEntry{}).Where("entity = ? AND entity_id IN ?", "users", uuids).
+			Update("changes", gorm.Expr(redactedChanges)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OutboxEvent{}).Where("aggregate_id IN ?", uuids).
+			Update("payload", gorm.Expr(redactedPayload)).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("uuid IN ? AND deleted_at IS NOT NULL", uuids).Delete(&User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+
+		for _, userUUID := range uuids {
+			if err := appendAudit(tx, "users", userUUID, "purge", AuditDiff{}); err != nil {
+				return err
+			}
+			if err := appendOutbox(tx, "user.purged", userUUID, map[string]string{"uuid": userUUID}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("error purging users: %w", err)
+	}
+
+	return purged, nil
+}
+
+// migrateNameIndex replaces the original table-wide unique index on name
+// with one covering live users only, so a deleted user's name is free to
+// reuse. AutoMigrate creates the replacement.
+func migrateNameIndex() error {
+
+	if db.Migrator().HasIndex(&User{}, "idx_users_name") {
+		return db.Migrator().DropIndex(&User{}, "idx_users_name")
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -13,6 +14,8 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/i101dev/multimodal-db/metrics"
+	"github.com/i101dev/multimodal-db/tracing"
 	"github.com/i101dev/multimodal-db/util"
 )
 
@@ -26,10 +29,13 @@ var db *gorm.DB
 
 type User struct {
 	gorm.Model
-	UUID     string `json:"uuid"`
-	Name     string `gorm:"uniqueIndex" json:"name"`
-	Location string `json:"location"`
-	Skills   Skills `gorm:"type:jsonb" json:"skills"`
+	UUID         string `json:"uuid"`
+	Name         string `gorm:"uniqueIndex:idx_users_name_live,where:deleted_at IS NULL" json:"name"`
+	Location     string `json:"location"`
+	Skills       Skills `gorm:"type:jsonb" json:"skills"`
+	Version      int    `gorm:"not null;default:1" json:"version"`
+	PasswordHash string `json:"-"`
+	Password     string `gorm:"-" json:"password,omitempty"`
 }
 
 type Skills []Skill
@@ -40,6 +46,28 @@ type Skill struct {
 	Level int    `json:"level"`
 }
 
+var ErrForbidden = errors.New("forbidden")
+
+type actingUserKey struct{}
+
+// WithActingUser marks ctx as belonging to a logged-in user. Mutations made
+// under such a context are confined to that user's own record.
+func WithActingUser(ctx context.Context, userUUID string) context.Context {
+	return context.WithValue(ctx, actingUserKey{}, userUUID)
+}
+
+func ActingUser(ctx context.Context) (string, bool) {
+	userUUID, ok := ctx.Value(actingUserKey{}).(string)
+	return userUUID, ok
+}
+
+func checkActingUser(ctx context.Context, userUUID string) error {
+	if acting, ok := ActingUser(ctx); ok && acting != userUUID {
+		return ErrForbidden
+	}
+	return nil
+}
+
 func (s Skills) Value() (driver.Value, error) {
 	return json.Marshal(s)
 }
@@ -56,6 +84,10 @@ func (s *Skills) Scan(src interface{}) error {
 
 func ConnectDB() {
 
+	if db != nil {
+		return
+	}
+
 	dbUser := os.Getenv("DB_POSTGRES_USER")
 	dbPass := os.Getenv("DB_POSTGRES_PASS")
 	dbName := os.Getenv("DB_POSTGRES_NAME")
@@ -77,20 +109,40 @@ func ConnectDB() {
 
 	db = d
 
+	if err := db.Use(metrics.GormPlugin{Store: "postgres"}); err != nil {
+		log.Fatal("Error registering metrics plugin:", err)
+	}
+	if err := db.Use(tracing.GormPlugin{System: "postgresql"}); err != nil {
+		log.Fatal("Error registering tracing plugin:", err)
+	}
+
 	// ----------------------------------------------------
 	// Migrations -----------------------------------------
 	//
-	if err := db.AutoMigrate(&User{}); err != nil {
+	if err := migrateNameIndex(); err != nil {
+		log.Fatal("Error migrating [models/softdelete.go]:", err)
+	}
+	if err := db.AutoMigrate(&User{}, &APIKey{}, &Policy{}, &RoleBinding{}, &AuditEntry{}, &UserRevision{}, &OutboxEvent{}, &AlertRule{}, &LockFence{}); err != nil {
 		log.Fatal("Error initializing [models/users.go]:", err)
 	}
+	if err := backfillRevisions(); err != nil {
+		log.Fatal("Error backfilling [models/revision.go]:", err)
+	}
+	if err := seedPolicies(); err != nil {
+		log.Fatal("Error seeding [models/rbac.go]:", err)
+	}
 }
 
 func CreateUser(r *http.Request) (*User, error) {
 
+	if _, ok := ActingUser(r.Context()); ok {
+		return nil, ErrForbidden
+	}
+
 	requestBody, userData, _ := userData_byName(r)
 
 	if userData != nil {
-		return nil, fmt.Errorf("name already in play")
+		return nil, ErrNameConflict
 	}
 
 	// ----------------------------------------------
@@ -101,14 +153,34 @@ func CreateUser(r *http.Request) (*User, error) {
 	if requestBody.Location == "" {
 		return nil, fmt.Errorf("invalid [location]")
 	}
+	if requestBody.Password != "" && len(requestBody.Password) < minPasswordLen {
+		return nil, fmt.Errorf("invalid [password]: must be at least %d characters", minPasswordLen)
+	}
 	//
 	// ----------------------------------------------
 
 	requestBody.UUID = uuid.New().String()
 	requestBody.Skills = []Skill{}
+	requestBody.Version = 1
+
+	if requestBody.Password != "" {
+		requestBody.PasswordHash = hashPassword(requestBody.Password)
+		requestBody.Password = ""
+	}
 
-	if result := db.Create(&requestBody); result.Error != nil {
-		return nil, result.Error
+	if err := db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&requestBody).Error; err != nil {
+			return err
+		}
+		if err := appendRevision(tx, requestBody, "create", false); err != nil {
+			return err
+		}
+		if err := appendOutbox(tx, "user.created", requestBody.UUID, requestBody); err != nil {
+			return err
+		}
+		return appendAudit(tx, "users", requestBody.UUID, "create", diffOf(nil, requestBody))
+	}); err != nil {
+		return nil, err
 	}
 
 	return requestBody, nil
@@ -118,7 +190,7 @@ func GetAllUsers(r *http.Request) (*[]User, error) {
 
 	allUsers := []User{}
 
-	result := db.Find(&allUsers)
+	result := db.WithContext(r.Context()).Find(&allUsers)
 
 	if result.Error != nil {
 		return &allUsers, result.Error
@@ -144,49 +216,91 @@ func FindUserByID(r *http.Request) (*User, error) {
 
 func UpdateUser(r *http.Request) (*User, error) {
 
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+
 	requestBody, userData, err := userData_byUUID(r)
 
 	if err != nil {
 		return nil, err
+	} else if err := checkActingUser(r.Context(), userData.UUID); err != nil {
+		return nil, err
 	} else if requestBody.Name == "" && requestBody.Location == "" {
 		return nil, fmt.Errorf("nothing to update")
 	}
 
 	// ----------------------------------------------
 	//
+	updates := map[string]interface{}{}
+
 	if requestBody.Name != "" {
-		userData.Name = requestBody.Name
+		updates["name"] = requestBody.Name
 	}
 	if requestBody.Location != "" {
-		userData.Location = requestBody.Location
+		updates["location"] = requestBody.Location
 	}
 	//
 	// ----------------------------------------------
 
-	if err := db.Save(&userData).Error; err != nil {
-		return nil, fmt.Errorf("error updating user: %w", err)
-	}
-
-	return userData, nil
+	return updateVersioned(r.Context(), userData.UUID, match, updates)
 }
 
 func DeleteUser(r *http.Request) error {
 
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
 	_, userData, err := userData_byUUID(r)
 
 	if err != nil {
 		return err
 	}
+	if err := checkActingUser(r.Context(), userData.UUID); err != nil {
+		return err
+	}
+
+	var before *User
+
+	err = db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+
+		before, err = lockUser(tx, userData.UUID, match)
+		if err != nil {
+			return err
+		}
 
-	if err := db.Delete(&userData).Error; err != nil {
-		return fmt.Errorf("error deleting user: %w", err)
+		if err := tx.Delete(before).Error; err != nil {
+			return fmt.Errorf("error deleting user: %w", err)
+		}
+		if err := appendRevision(tx, before, "delete", true); err != nil {
+			return err
+		}
+		if err := appendOutbox(tx, "user.deleted", before.UUID, before); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, "users", before.UUID, "delete", diffOf(before, nil))
+	})
+
+	if err != nil {
+		return err
 	}
 
+	invalidateUsers(r.Context(), before)
+
 	return nil
 }
 
 func AddSkill(r *http.Request) (*User, error) {
 
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+
 	var reqBody struct {
 		UUID  string `json:"uuid"`
 		Type  string `json:"type"`
@@ -206,35 +320,33 @@ func AddSkill(r *http.Request) (*User, error) {
 	if reqBody.Level < 1 {
 		return nil, fmt.Errorf("invalid [level]")
 	}
-
-	// ----------------------------------------------------------------------------
-	userDat := &User{}
-	if err := db.Where("uuid = ?", reqBody.UUID).First(userDat).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
-		}
-		return nil, fmt.Errorf("error retrieving user: %w", err)
+	if err := checkActingUser(r.Context(), reqBody.UUID); err != nil {
+		return nil, err
 	}
 
 	// ----------------------------------------------------------------------------
-	newSkill := Skill{
+	newSkill, err := json.Marshal(Skills{{
 		UUID:  uuid.New().String(),
 		Type:  reqBody.Type,
 		Level: reqBody.Level,
+	}})
+	if err != nil {
+		return nil, err
 	}
 
-	userDat.Skills = append(userDat.Skills, newSkill)
-
-	// ----------------------------------------------------------------------------
-	if err := db.Save(&userDat).Error; err != nil {
-		return nil, fmt.Errorf("error updating user")
-	}
-
-	return userDat, nil
+	// Appended in SQL so concurrent skill changes can't overwrite each other.
+	return updateVersioned(r.Context(), reqBody.UUID, match, map[string]interface{}{
+		"skills": gorm.Expr("COALESCE(skills, '[]'::jsonb) || ?::jsonb", string(newSkill)),
+	})
 }
 
 func RemoveSkill(r *http.Request) (*User, error) {
 
+	match, err := parseIfMatch(r)
+	if err != nil {
+		return nil, err
+	}
+
 	var reqBody struct {
 		UserUUID  string `json:"user_uuid"`
 		SkillUUID string `json:"skill_uuid"`
@@ -250,33 +362,36 @@ func RemoveSkill(r *http.Request) (*User, error) {
 	if reqBody.SkillUUID == "" {
 		return nil, fmt.Errorf("invalid skill [uuid]")
 	}
-
-	// --------------------------------------------------------------------------------
-	userDat := &User{}
-	if err := db.Where("uuid = ?", reqBody.UserUUID).First(userDat).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
-		}
-		return nil, fmt.Errorf("error retrieving user: %w", err)
+	if err := checkActingUser(r.Context(), reqBody.UserUUID); err != nil {
+		return nil, err
 	}
 
 	// --------------------------------------------------------------------------------
-	updSkills := []Skill{}
-	for _, skill := range userDat.Skills {
-		if skill.UUID != reqBody.SkillUUID {
-			updSkills = append(updSkills, skill)
-			break
-		}
+	hasSkill, err := json.Marshal([]map[string]string{{"uuid": reqBody.SkillUUID}})
+	if err != nil {
+		return nil, err
 	}
 
-	userDat.Skills = updSkills
+	// Filtered in SQL so concurrent skill changes can't overwrite each other.
+	userDat, err := updateVersioned(r.Context(), reqBody.UserUUID, match, map[string]interface{}{
+		"skills": gorm.Expr(`(
+			SELECT COALESCE(jsonb_agg(s.value ORDER BY s.ord), '[]'::jsonb)
+			FROM jsonb_array_elements(skills) WITH ORDINALITY AS s(value, ord)
+			WHERE s.value->>'uuid' <> ?
+		)`, reqBody.SkillUUID),
+	}, gorm.Expr("skills @> ?::jsonb", string(hasSkill)))
 
-	// --------------------------------------------------------------------------------
-	if err := db.Save(&userDat).Error; err != nil {
-		return nil, fmt.Errorf("error updating user: %w", err)
+	if err == nil && userDat == nil {
+		return nil, fmt.Errorf("skill not found")
 	}
 
-	return userDat, nil
+	return userDat, err
+}
+
+// GetUserByUUID looks a user up outside of any request body, for callers
+// that already hold the UUID (e.g. from a session token).
+func GetUserByUUID(ctx context.Context, userUUID string) (*User, error) {
+	return cachedUser(ctx, "uuid", userUUID)
 }
 
 // --------------------------------------------------------------------
@@ -294,13 +409,9 @@ func userData_byUUID(r *http.Request) (*User, *User, error) {
 		return &reqBody, nil, fmt.Errorf("invalid user [UUID]")
 	}
 
-	userData := &User{}
-
-	if err := db.Where("uuid = ?", reqBody.UUID).First(userData).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return &reqBody, nil, fmt.Errorf("user not found")
-		}
-		return &reqBody, nil, fmt.Errorf("error retrieving user: %w", err)
+	userData, err := cachedUser(r.Context(), "uuid", reqBody.UUID)
+	if err != nil {
+		return &reqBody, nil, err
 	}
 
 	// fmt.Printf("reqBody: %+v", reqBody)
@@ -320,13 +431,9 @@ func userData_byName(r *http.Request) (*User, *User, error) {
 		return &reqBody, nil, fmt.Errorf("invalid user [Name]")
 	}
 
-	userData := &User{}
-
-	if err := db.Where("name = ?", reqBody.Name).First(userData).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return &reqBody, nil, fmt.Errorf("user not found")
-		}
-		return &reqBody, nil, fmt.Errorf("error retrieving user: %w", err)
+	userData, err := cachedUser(r.Context(), "name", reqBody.Name)
+	if err != nil {
+		return &reqBody, nil, err
 	}
 
 	return &reqBody, userData, nil
@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+var (
+	ErrPreconditionRequired = errors.New("If-Match header required")
+	ErrVersionMismatch      = errors.New("user has been modified; refetch and retry")
+)
+
+// ETag renders a user's version as a strong entity tag.
+func (u *User) ETag() string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// ifMatch is the set of versions a mutation may apply to, read from
+// If-Match. nil, from "*", accepts whatever the current version is.
+type ifMatch []int
+
+func (m ifMatch) accepts(version int) bool {
+	return m == nil || slices.Contains(m, version)
+}
+
+// parseIfMatch reads If-Match as a comma-separated list of entity tags.
+// If-Match calls for strong comparison (RFC 9110 13.1.1), so weak tags
+// never match; a header naming no strong tag of ours fails outright.
+func parseIfMatch(r *http.Request) (ifMatch, error) {
+
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if header == "" {
+		return nil, ErrPreconditionRequired
+	}
+	if header == "*" {
+		return nil, nil
+	}
+
+	match := ifMatch{}
+
+	for _, tag := range strings.Split(header, ",") {
+
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && version > 0 {
+			match = append(match, version)
+		}
+	}
+
+	if len(match) == 0 {
+		return nil, ErrVersionMismatch
+	}
+
+	return match, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// updateVersioned applies updates to a user in one conditional UPDATE,
+// bumping its version, and only if it is still at a version match
+// accepts. extra adds further conditions a row must meet to be touched;
+// when the user exists at the right version but fails one of those, the
+// result is nil, nil. The change is audited in the same transaction.
+func updateVersioned(ctx context.Context, userUUID string, match ifMatch, updates map[string]interface{}, extra ...clause.Expression) (*User, error) {
+
+	updates["version"] = gorm.Expr("version + 1")
+
+	var before, userDat *User
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var err error
+
+		before, err = lockUser(tx, userUUID, match)
+		if err != nil {
+			return err
+		}
+
+		after := &User{}
+		q := tx.Model(after).Clauses(clause.Returning{}).Where("uuid = ?", userUUID)
+
+		for _, cond := range extra {
+			q = q.Where(cond)
+		}
+
+		result := q.Updates(updates)
+
+		if isUniqueViolation(result.Error) {
+			return ErrNameConflict
+		}
+		if result.Error != nil {
+			return fmt.Errorf("error updating user: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		userDat = after
+
+		if err := appendRevision(tx, after, "update", false); err != nil {
+			return err
+		}
+		if err := appendOutbox(tx, "user.updated", userUUID, after); err != nil {
+			return err
+		}
+		return appendAudit(tx, "users", userUUID, "update", diffOf(before, after))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Both names: a rename must not leave the old one cached.
+	if userDat != nil {
+		invalidateUsers(ctx, before, userDat)
+	}
+
+	return userDat, nil
+}
+
+// lockUser reads a user FOR UPDATE and checks it is still at a version
+// match accepts, so what's read is what the following write replaces.
+func lockUser(tx *gorm.DB, userUUID string, match ifMatch) (*User, error) {
+
+	userDat := &User{}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", userUUID).First(userDat).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	if !match.accepts(userDat.Version) {
+		return nil, ErrVersionMismatch
+	}
+
+	return userDat, nil
+}
@@ -6,58 +6,112 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/leader"
+	"github.com/i101dev/multimodal-db/metrics"
+	"github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/tracing"
 )
 
 // --------------------------------------------------------------------
 // --------------------------------------------------------------------
 
 type Alert struct {
-	UUID      string `json:"uuid"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	Timestamp int64  `json:"timestamp"`
+	UUID      string   `json:"uuid"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	Timestamp int64    `json:"timestamp"`
+	Severity  string   `json:"severity"`
+	Source    string   `json:"source"`
+	Tags      []string `json:"tags,omitempty"`
+	Rule      string   `json:"rule,omitempty"`
+	TxnUUIDs  []string `json:"txn_uuids,omitempty"`
+
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Occurrences int    `json:"occurrences,omitempty"`
+	FirstSeen   int64  `json:"first_seen,omitempty"`
+	LastSeen    int64  `json:"last_seen,omitempty"`
+
+	SilencedBy []string `json:"silenced_by,omitempty"`
+
+	Status         string `json:"status"`
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt int64  `json:"acknowledged_at,omitempty"`
+	ResolvedBy     string `json:"resolved_by,omitempty"`
+	ResolvedAt     int64  `json:"resolved_at,omitempty"`
 }
 
 // --------------------------------------------------------------------
 // --------------------------------------------------------------------
 
-var rdb *redis.Client
-var ctx = context.Background()
+var rdb redis.UniversalClient
+
+// Under Cluster, only keys written together in one MULTI share a hash
+// tag. Each alert is tagged with its own UUID, so alerts spread across
+// the cluster. The status and severity indexes share {alert-index}, so
+// they can be intersected, and are updated after the alert rather than
+// with it.
+const (
+	alertKeyPrefix = "alert:"
+	alertIndexTag  = "{alert-index}"
+	allAlertsKey   = alertIndexTag + ":all"
+)
+
+func alertKey(alertUUID string) string {
+	return alertKeyPrefix + "{" + alertUUID + "}"
+}
 
 func ConnectDB() {
 
-	redisHost := os.Getenv("DB_REDIS_HOST")
-	redisPort := os.Getenv("DB_REDIS_PORT")
-	redisPassword := os.Getenv("DB_REDIS_PASSWORD")
+	if rdb != nil {
+		return
+	}
 
-	if redisHost == "" || redisPort == "" {
-		log.Fatal("incomplete Redis connection parameters")
+	client, mode, err := newClient()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	addr := fmt.Sprintf("%s:%s", redisHost, redisPort)
+	rdb = client
+
+	// Jobs elected through leader now coordinate across every instance.
+	// Without Redis nothing connects, and leader keeps its in-process
+	// locker.
+	leader.SetLocker(redisLocker{})
 
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: redisPassword,
-		DB:       0, // use default DB
-	})
+	rdb.AddHook(metrics.RedisHook{})
+	rdb.AddHook(tracing.RedisHook{})
 
-	_, err := rdb.Ping(ctx).Result()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = rdb.Ping(ctx).Result()
 	if err != nil {
 		log.Fatal("\n*** >>> Redis connection failed:", err)
 		return
 	}
 
-	fmt.Println("Redis connected successfully")
+	if err := migrateKeyLayout(context.Background(), mode); err != nil {
+		log.Fatal("Error migrating keys [models/redis/keylayout.go]:", err)
+	}
+	if err := indexSearchBackfill(context.Background()); err != nil {
+		log.Fatal("Error indexing alerts [models/redis/search.go]:", err)
+	}
+	if err := indexLegacyAlerts(context.Background()); err != nil {
+		log.Fatal("Error indexing alerts [models/redis/lifecycle.go]:", err)
+	}
+
+	fmt.Printf("Redis connected successfully (%s)\n", mode)
 }
 
 func CreateAlert(r *http.Request) (*Alert, error) {
 
+	ctx := r.Context()
+
 	var requestBody Alert
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -72,39 +126,73 @@ func CreateAlert(r *http.Request) (*Alert, error) {
 		return nil, fmt.Errorf("invalid [body]")
 	}
 
+	if requestBody.Severity == "" {
+		requestBody.Severity = SeverityInfo
+	}
+	if !validSeverity(requestBody.Severity) {
+		return nil, fmt.Errorf("invalid [severity]: must be info, warning or critical")
+	}
+	if requestBody.Source == "" {
+		requestBody.Source = "api"
+	}
+
 	requestBody.UUID = uuid.New().String()
 	requestBody.Timestamp = time.Now().Unix()
+	requestBody.Rule = "" // only set on alerts raised by a rule
+	requestBody.SilencedBy = nil
+	requestBody.Status = StatusOpen
+	requestBody.AcknowledgedBy, requestBody.AcknowledgedAt = "", 0
+	requestBody.ResolvedBy, requestBody.ResolvedAt = "", 0
 
 	// -------------------------------------------------------------
-	alertJSON, err := json.Marshal(requestBody)
+	alert, created, err := saveOrCollapse(ctx, &requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize alert: %v", err)
+		return nil, err
 	}
 
-	err = rdb.Set(ctx, requestBody.UUID, alertJSON, 0).Err()
-	if err != nil {
-		return nil, fmt.Errorf("failed to save alert: %v", err)
+	// Repeats only bump the original's count; auditing each would let a
+	// noisy producer flood the log.
+	if !created {
+		return alert, nil
 	}
 
-	return &requestBody, nil
+	// Redis and Postgres can't commit together; the alert stands either way.
+	if err := postgres.RecordAudit(ctx, "alerts", alert.UUID, "create", nil, alert); err != nil {
+		log.Println("Error auditing alert", alert.UUID+":", err)
+	}
+
+	enqueueWebhooks(ctx, alert)
+
+	return alert, nil
 }
 
+// GetAllAlerts lists alerts, narrowed by the status and severity query
+// parameters when given.
 func GetAllAlerts(r *http.Request) (*[]Alert, error) {
 
+	ctx := r.Context()
+
 	var allAlerts []Alert
 
-	keys, err := rdb.Keys(ctx, "*").Result()
+	alertUUIDs, err := alertUUIDs(ctx, r.URL.Query().Get("status"), r.URL.Query().Get("severity"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch keys: %v", err)
+		return nil, err
 	}
 
-	if len(keys) == 0 {
+	if len(alertUUIDs) == 0 {
 		return &allAlerts, fmt.Errorf("no alerts yet")
 	}
 
 	// -------------------------------------------------------------
-	for _, key := range keys {
-		alertJSON, err := rdb.Get(ctx, key).Result()
+	for _, alertUUID := range alertUUIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		alertJSON, err := rdb.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get alert: %v", err)
 		}
@@ -123,6 +211,8 @@ func GetAllAlerts(r *http.Request) (*[]Alert, error) {
 
 func GetRecentAlerts(r *http.Request) (*[]Alert, error) {
 
+	ctx := r.Context()
+
 	var requestBody struct {
 		Minutes int64 `json:"minutes"`
 	}
@@ -137,14 +227,21 @@ func GetRecentAlerts(r *http.Request) (*[]Alert, error) {
 	currentTime := time.Now().Unix()
 	cutoffTime := currentTime - requestBody.Minutes*60
 
-	keys, err := rdb.Keys(ctx, "*").Result()
+	alertUUIDs, err := alertUUIDs(ctx, "", "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch keys: %v", err)
+		return nil, err
 	}
 
 	// -------------------------------------------------------------
-	for _, key := range keys {
-		alertJSON, err := rdb.Get(ctx, key).Result()
+	for _, alertUUID := range alertUUIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		alertJSON, err := rdb.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to get alert: %v", err)
 		}
@@ -0,0 +1,305 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Every new alert is appended to AlertStream as a single "alert" field
+// holding its JSON. The stream is capped near alertStreamLen entries; a
+// group that falls further behind than that loses the oldest.
+const (
+	AlertStream    = "alerts:stream"
+	alertStreamLen = 100000
+
+	defaultConsumerBatch     = 10
+	defaultConsumerBlock     = 5 * time.Second
+	defaultConsumerClaimIdle = time.Minute
+	defaultMaxDeliveries     = 10
+)
+
+// AlertHandler processes one alert read from AlertStream. An error leaves
+// the message pending, to be delivered again once it has sat idle for
+// the consumer's ClaimIdle.
+type AlertHandler func(ctx context.Context, alert *Alert) error
+
+// AlertConsumer reads AlertStream as one member of a consumer group.
+// Delivery is at least once: a message is acknowledged only after its
+// handler succeeds, and messages left pending by a failed or crashed
+// consumer are claimed by the others.
+type AlertConsumer struct {
+	Group   string
+	Name    string
+	Handler AlertHandler
+
+	BatchSize     int64         // messages per read
+	Block         time.Duration // how long a read waits for new messages
+	ClaimIdle     time.Duration // how long a message sits pending before it is claimed
+	MaxDeliveries int64         // deliveries before a message is dropped as poison
+}
+
+// ConsumerGroup reports a group's progress through AlertStream.
+type ConsumerGroup struct {
+	Name            string         `json:"name"`
+	LastDeliveredID string         `json:"last_delivered_id"`
+	Lag             int64          `json:"lag"`
+	Pending         int64          `json:"pending"`
+	Consumers       []ConsumerInfo `json:"consumers"`
+}
+
+type ConsumerInfo struct {
+	Name    string `json:"name"`
+	Pending int64  `json:"pending"`
+	IdleMs  int64  `json:"idle_ms"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func NewAlertConsumer(group, name string, handler AlertHandler) *AlertConsumer {
+
+	return &AlertConsumer{
+		Group:         group,
+		Name:          name,
+		Handler:       handler,
+		BatchSize:     defaultConsumerBatch,
+		Block:         defaultConsumerBlock,
+		ClaimIdle:     defaultConsumerClaimIdle,
+		MaxDeliveries: defaultMaxDeliveries,
+	}
+}
+
+// Run consumes until ctx is cancelled, creating the group, starting from
+// the beginning of the stream, if it doesn't exist yet. It first
+// finishes whatever this consumer left pending before it last stopped.
+func (c *AlertConsumer) Run(ctx context.Context) error {
+
+	err := rdb.XGroupCreateMkStream(ctx, AlertStream, c.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %v", err)
+	}
+
+	if err := c.read(ctx, "0"); err != nil {
+		return err
+	}
+
+	lastClaim := time.Now()
+
+	for ctx.Err() == nil {
+
+		if time.Since(lastClaim) >= c.ClaimIdle {
+			if err := c.claim(ctx); err != nil {
+				log.Println("Error claiming stalled alerts:", err)
+			}
+			lastClaim = time.Now()
+		}
+
+		if err := c.read(ctx, ">"); err != nil && ctx.Err() == nil {
+			log.Println("Error reading alert stream:", err)
+			time.Sleep(time.Second)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// GetAlertConsumers reports lag and pending counts for every consumer
+// group reading AlertStream.
+func GetAlertConsumers(r *http.Request) (*[]ConsumerGroup, error) {
+
+	ctx := r.Context()
+
+	groups := []ConsumerGroup{}
+
+	if n, err := rdb.Exists(ctx, AlertStream).Result(); err != nil {
+		return nil, fmt.Errorf("failed to read alert stream: %v", err)
+	} else if n == 0 {
+		return &groups, nil
+	}
+
+	infos, err := rdb.XInfoGroups(ctx, AlertStream).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consumer groups: %v", err)
+	}
+
+	// -------------------------------------------------------------
+	for _, info := range infos {
+
+		consumers, err := rdb.XInfoConsumers(ctx, AlertStream, info.Name).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read consumers: %v", err)
+		}
+
+		group := ConsumerGroup{
+			Name:            info.Name,
+			LastDeliveredID: info.LastDeliveredID,
+			Lag:             info.Lag,
+			Pending:         info.Pending,
+			Consumers:       make([]ConsumerInfo, 0, len(consumers)),
+		}
+
+		for _, consumer := range consumers {
+			group.Consumers = append(group.Consumers, ConsumerInfo{
+				Name:    consumer.Name,
+				Pending: consumer.Pending,
+				IdleMs:  consumer.Idle.Milliseconds(),
+			})
+		}
+
+		groups = append(groups, group)
+	}
+
+	return &groups, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// read handles one batch: new messages for ">", or this consumer's own
+// pending messages, all of them, for "0".
+func (c *AlertConsumer) read(ctx context.Context, from string) error {
+
+	for {
+
+		args := &redis.XReadGroupArgs{
+			Group:    c.Group,
+			Consumer: c.Name,
+			Streams:  []string{AlertStream, from},
+			Count:    c.BatchSize,
+			Block:    c.Block,
+		}
+		if from != ">" {
+			args.Block = -1 // history reads never block
+		}
+
+		streams, err := rdb.XReadGroup(ctx, args).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		messages := streams[0].Messages
+		for _, msg := range messages {
+			c.handle(ctx, msg)
+		}
+
+		// New messages come one batch per call. Pending ones are paged
+		// through by ID until none are left past the last seen.
+		if from == ">" || len(messages) == 0 {
+			return nil
+		}
+		from = messages[len(messages)-1].ID
+	}
+}
+
+// claim takes over messages another consumer, or this one, left pending
+// for longer than ClaimIdle, dropping any already delivered
+// MaxDeliveries times.
+func (c *AlertConsumer) claim(ctx context.Context) error {
+
+	start := "-"
+
+	for {
+
+		pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: AlertStream,
+			Group:  c.Group,
+			Idle:   c.ClaimIdle,
+			Start:  start,
+			End:    "+",
+			Count:  c.BatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		var ids []string
+
+		for _, p := range pending {
+			if p.RetryCount < c.MaxDeliveries {
+				ids = append(ids, p.ID)
+				continue
+			}
+
+			log.Printf("Dropping alert stream message %s after %d deliveries", p.ID, p.RetryCount)
+			if err := rdb.XAck(ctx, AlertStream, c.Group, p.ID).Err(); err != nil {
+				return err
+			}
+		}
+
+		if len(ids) > 0 {
+			messages, err := rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   AlertStream,
+				Group:    c.Group,
+				Consumer: c.Name,
+				MinIdle:  c.ClaimIdle,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return err
+			}
+
+			for _, msg := range messages {
+				c.handle(ctx, msg)
+			}
+		}
+
+		start = "(" + pending[len(pending)-1].ID
+	}
+}
+
+// handle runs the handler for one message and acknowledges it if the
+// handler succeeds. A message that isn't an alert can never succeed, so
+// it is acknowledged straight away.
+func (c *AlertConsumer) handle(ctx context.Context, msg redis.XMessage) {
+
+	var alert Alert
+
+	alertJSON, _ := msg.Values["alert"].(string)
+	if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+		log.Printf("Dropping malformed alert stream message %s: %v", msg.ID, err)
+	} else if err := c.Handler(ctx, &alert); err != nil {
+		log.Printf("Error handling alert stream message %s: %v", msg.ID, err)
+		return
+	}
+
+	if err := rdb.XAck(ctx, AlertStream, c.Group, msg.ID).Err(); err != nil {
+		log.Printf("Error acknowledging alert stream message %s: %v", msg.ID, err)
+	}
+}
+
+// appendAlertStream appends a new alert to AlertStream.
+func appendAlertStream(ctx context.Context, alert *Alert) error {
+
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %v", err)
+	}
+
+	err = rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: AlertStream,
+		MaxLen: alertStreamLen,
+		Approx: true,
+		Values: map[string]interface{}{"alert": alertJSON},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to append alert to stream: %v", err)
+	}
+
+	return nil
+}
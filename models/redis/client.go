@@ -0,0 +1,246 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// newClient builds the client ConnectDB uses from the environment.
+//
+//	DB_REDIS_MODE              standalone (default), sentinel or cluster
+//	DB_REDIS_HOST, _PORT       the server, in standalone mode
+//	DB_REDIS_ADDRS             comma-separated host:port list: the sentinels, or
+//	                           the cluster seed nodes (also accepted in standalone)
+//	DB_REDIS_MASTER            the master name, in sentinel mode
+//	DB_REDIS_SENTINEL_PASSWORD password for the sentinels themselves
+//	DB_REDIS_USERNAME, _PASSWORD
+//	DB_REDIS_DB                database index (default 0; not in cluster mode)
+//	DB_REDIS_TLS               "true" to connect over TLS
+//	DB_REDIS_TLS_CA_FILE       PEM bundle to verify the server with
+//	DB_REDIS_TLS_CERT_FILE, _KEY_FILE  client certificate
+//	DB_REDIS_TLS_SERVER_NAME   name to verify, if not the dialled host
+//	DB_REDIS_POOL_SIZE         connections per node (default 10 per CPU)
+//	DB_REDIS_MIN_IDLE_CONNS
+//	DB_REDIS_POOL_TIMEOUT, DB_REDIS_DIAL_TIMEOUT, DB_REDIS_READ_TIMEOUT,
+//	DB_REDIS_WRITE_TIMEOUT     durations, e.g. "3s"
+func newClient() (redis.UniversalClient, string, error) {
+
+	mode := os.Getenv("DB_REDIS_MODE")
+	if mode == "" {
+		mode = ModeStandalone
+	}
+
+	addrs := redisAddrs()
+
+	tlsConfig, err := redisTLSConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	dbIndex := 0
+	if v := os.Getenv("DB_REDIS_DB"); v != "" {
+		if dbIndex, err = strconv.Atoi(v); err != nil || dbIndex < 0 {
+			return nil, "", fmt.Errorf("invalid DB_REDIS_DB %q", v)
+		}
+	}
+
+	username := os.Getenv("DB_REDIS_USERNAME")
+	password := os.Getenv("DB_REDIS_PASSWORD")
+
+	poolSize := envInt("DB_REDIS_POOL_SIZE")
+	minIdleConns := envInt("DB_REDIS_MIN_IDLE_CONNS")
+	poolTimeout := envTimeout("DB_REDIS_POOL_TIMEOUT")
+	dialTimeout := envTimeout("DB_REDIS_DIAL_TIMEOUT")
+	readTimeout := envTimeout("DB_REDIS_READ_TIMEOUT")
+	writeTimeout := envTimeout("DB_REDIS_WRITE_TIMEOUT")
+
+	// -------------------------------------------------------------
+	switch mode {
+
+	case ModeStandalone:
+		if len(addrs) != 1 {
+			return nil, "", fmt.Errorf("incomplete Redis connection parameters")
+		}
+
+		return redis.NewClient(&redis.Options{
+			Addr:         addrs[0],
+			Username:     username,
+			Password:     password,
+			DB:           dbIndex,
+			TLSConfig:    tlsConfig,
+			PoolSize:     poolSize,
+			MinIdleConns: minIdleConns,
+			PoolTimeout:  poolTimeout,
+			DialTimeout:  dialTimeout,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+		}), mode, nil
+
+	case ModeSentinel:
+		master := os.Getenv("DB_REDIS_MASTER")
+		if master == "" || len(addrs) == 0 {
+			return nil, "", fmt.Errorf("sentinel mode needs DB_REDIS_MASTER and DB_REDIS_ADDRS")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       master,
+			SentinelAddrs:    addrs,
+			SentinelPassword: os.Getenv("DB_REDIS_SENTINEL_PASSWORD"),
+			Username:         username,
+			Password:         password,
+			DB:               dbIndex,
+			TLSConfig:        tlsConfig,
+			PoolSize:         poolSize,
+			MinIdleConns:     minIdleConns,
+			PoolTimeout:      poolTimeout,
+			DialTimeout:      dialTimeout,
+			ReadTimeout:      readTimeout,
+			WriteTimeout:     writeTimeout,
+		}), mode, nil
+
+	case ModeCluster:
+		if len(addrs) == 0 {
+			return nil, "", fmt.Errorf("cluster mode needs DB_REDIS_ADDRS")
+		}
+		if dbIndex != 0 {
+			return nil, "", fmt.Errorf("DB_REDIS_DB is not supported in cluster mode")
+		}
+
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        addrs,
+			Username:     username,
+			Password:     password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     poolSize,
+			MinIdleConns: minIdleConns,
+			PoolTimeout:  poolTimeout,
+			DialTimeout:  dialTimeout,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+		}), mode, nil
+	}
+
+	return nil, "", fmt.Errorf("invalid DB_REDIS_MODE %q: must be standalone, sentinel or cluster", mode)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Configured reports whether the environment names a Redis deployment.
+// Without one the service still runs, minus the features that live in
+// Redis, and the rest fall back to per-instance state.
+func Configured() bool {
+	return len(redisAddrs()) > 0
+}
+
+// Enabled reports whether ConnectDB has been called, for features that can
+// fall back to local state when Redis isn't part of the deployment.
+func Enabled() bool {
+	return rdb != nil
+}
+
+func redisAddrs() []string {
+
+	var addrs []string
+
+	for _, addr := range strings.Split(os.Getenv("DB_REDIS_ADDRS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		host, port := os.Getenv("DB_REDIS_HOST"), os.Getenv("DB_REDIS_PORT")
+		if host != "" && port != "" {
+			addrs = append(addrs, fmt.Sprintf("%s:%s", host, port))
+		}
+	}
+
+	return addrs
+}
+
+func redisTLSConfig() (*tls.Config, error) {
+
+	if os.Getenv("DB_REDIS_TLS") != "true" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: os.Getenv("DB_REDIS_TLS_SERVER_NAME"),
+	}
+
+	if caFile := os.Getenv("DB_REDIS_TLS_CA_FILE"); caFile != "" {
+
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DB_REDIS_TLS_CA_FILE: %v", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in DB_REDIS_TLS_CA_FILE")
+		}
+	}
+
+	certFile, keyFile := os.Getenv("DB_REDIS_TLS_CERT_FILE"), os.Getenv("DB_REDIS_TLS_KEY_FILE")
+	if certFile != "" || keyFile != "" {
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %v", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func envInt(name string) int {
+
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("invalid %s %q", name, v)
+	}
+
+	return n
+}
+
+// envTimeout reads a duration; zero leaves the client's default.
+func envTimeout(name string) time.Duration {
+
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid %s %q", name, v)
+	}
+
+	return d
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// EventStream and the markers that dedup it share a hash tag, for the
+// script that appends to it.
+const (
+	eventTag       = "{events}"
+	EventStream    = eventTag + ":stream"
+	eventStreamLen = 100000
+
+	// The marker only has to outlive the relay's retries.
+	eventKeyPrefix = eventTag + ":seen:"
+	eventKeyTTL    = 24 * time.Hour
+)
+
+// Only a new user is worth an alert; every event still goes to
+// EventStream.
+const alertingEvent = "user.created"
+
+// Appends the event to its stream unless its marker already exists.
+var appendEvent = redis.NewScript(`
+if not redis.call('SET', KEYS[1], '1', 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*',
+	'event_id', ARGV[3], 'type', ARGV[4], 'aggregate_id', ARGV[5], 'payload', ARGV[6])
+
+return 1
+`)
+
+// PublishEvent appends an outbox event to EventStream, and reports whether
+// the event was new. A user.created event also raises an alert, appended
+// to AlertStream like any other. The alert is keyed by the event ID and
+// only saved if it doesn't exist yet, and the event is appended last, so
+// a redelivery neither raises the alert twice nor loses the event.
+func PublishEvent(ctx context.Context, ev *postgres.OutboxEvent) (bool, error) {
+
+	if ev.Type == alertingEvent {
+		if err := raiseEventAlert(ctx, ev); err != nil {
+			return false, err
+		}
+	}
+
+	created, err := appendEvent.Run(ctx, rdb, []string{eventKeyPrefix + ev.EventID, EventStream},
+		eventKeyTTL.Milliseconds(), eventStreamLen, ev.EventID, ev.Type, ev.AggregateID, ev.Payload).Int()
+
+	if err != nil {
+		return false, fmt.Errorf("failed to publish event: %v", err)
+	}
+
+	return created == 1, nil
+}
+
+func raiseEventAlert(ctx context.Context, ev *postgres.OutboxEvent) error {
+
+	alert := &Alert{
+		UUID:      ev.EventID,
+		Title:     ev.Type,
+		Body:      fmt.Sprintf("%s [%s]", ev.Type, ev.AggregateID),
+		Timestamp: ev.CreatedAt.Unix(),
+		Severity:  SeverityInfo,
+		Source:    "outbox",
+		Status:    StatusOpen,
+	}
+
+	applySilences(ctx, alert)
+
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %v", err)
+	}
+
+	created, err := rdb.SetNX(ctx, alertKey(alert.UUID), alertJSON, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to save alert: %v", err)
+	}
+	if !created {
+		return nil
+	}
+
+	if err := indexSavedAlert(ctx, alert); err != nil {
+		return err
+	}
+	if err := appendAlertStream(ctx, alert); err != nil {
+		return err
+	}
+
+	enqueueWebhooks(ctx, alert)
+
+	return nil
+}
@@ -0,0 +1,309 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	fingerprintPrefix = "alerts:fingerprint:"
+
+	defaultDedupWindow = 5 * time.Minute
+)
+
+var (
+	defaultFingerprintFields = []string{"title", "source", "tags"}
+	fingerprintableFields    = []string{"title", "body", "source", "tags", "severity", "rule"}
+)
+
+type dedupConfig struct {
+	fields []string
+	window time.Duration
+}
+
+var loadDedupConfig = sync.OnceValue(func() dedupConfig {
+
+	cfg := dedupConfig{
+		fields: defaultFingerprintFields,
+		window: util.EnvDuration("ALERT_DEDUP_WINDOW", defaultDedupWindow),
+	}
+
+	if env := os.Getenv("ALERT_FINGERPRINT_FIELDS"); env != "" {
+		cfg.fields = nil
+		for _, field := range strings.Split(env, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(fingerprintableFields, field) {
+				log.Fatalf("invalid ALERT_FINGERPRINT_FIELDS entry %q", field)
+			}
+			cfg.fields = append(cfg.fields, field)
+		}
+	}
+
+	return cfg
+})
+
+// AlertGroup summarises every alert sharing a fingerprint.
+type AlertGroup struct {
+	Fingerprint string   `json:"fingerprint"`
+	Title       string   `json:"title"`
+	Source      string   `json:"source"`
+	Tags        []string `json:"tags,omitempty"`
+	Severity    string   `json:"severity"`
+	Alerts      int      `json:"alerts"`
+	Open        int      `json:"open"`
+	Occurrences int      `json:"occurrences"`
+	FirstSeen   int64    `json:"first_seen"`
+	LastSeen    int64    `json:"last_seen"`
+	Latest      string   `json:"latest"`
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// GetAlertGroups lists alerts grouped by fingerprint, most recently seen
+// first, narrowed by the status and severity query parameters.
+func GetAlertGroups(r *http.Request) (*[]AlertGroup, error) {
+
+	ctx := r.Context()
+
+	alertUUIDs, err := alertUUIDs(ctx, r.URL.Query().Get("status"), r.URL.Query().Get("severity"))
+	if err != nil {
+		return nil, err
+	}
+
+	byFingerprint := map[string]*AlertGroup{}
+
+	for _, alertUUID := range alertUUIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		alertJSON, err := rdb.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get alert: %v", err)
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return nil, fmt.Errorf("failed to deserialize alert: %v", err)
+		}
+
+		// Alerts from before fingerprinting each stand alone.
+		fp := alert.Fingerprint
+		if fp == "" {
+			fp = alert.UUID
+		}
+
+		group, ok := byFingerprint[fp]
+		if !ok {
+			group = &AlertGroup{Fingerprint: fp, FirstSeen: alert.firstSeen()}
+			byFingerprint[fp] = group
+		}
+
+		group.add(&alert)
+	}
+
+	groups := make([]AlertGroup, 0, len(byFingerprint))
+	for _, group := range byFingerprint {
+		groups = append(groups, *group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].LastSeen > groups[j].LastSeen
+	})
+
+	return &groups, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// saveOrCollapse saves a new alert unless an unresolved alert with the
+// same fingerprint was seen within the dedup window, in which case that
+// alert's occurrence count and last-seen time are bumped instead. It
+// returns the alert that was saved or bumped, and whether it is new.
+//
+// The fingerprint key names the alert it collapses into. A new alert
+// claims it before being saved, so of two racing to raise the same
+// fingerprint only one is saved and the other collapses into it.
+func saveOrCollapse(ctx context.Context, alert *Alert) (*Alert, bool, error) {
+
+	cfg := loadDedupConfig()
+
+	alert.Fingerprint = alert.fingerprint(cfg.fields)
+	alert.Occurrences = 1
+	alert.FirstSeen = alert.Timestamp
+	alert.LastSeen = alert.Timestamp
+
+	applySilences(ctx, alert)
+
+	fpKey := fingerprintPrefix + alert.Fingerprint
+
+	for i := 0; i < maxTransitionRetries; i++ {
+
+		existingUUID, err := rdb.Get(ctx, fpKey).Result()
+		if err != nil && err != redis.Nil {
+			return nil, false, fmt.Errorf("failed to save alert: %v", err)
+		}
+
+		if existingUUID != "" {
+
+			existing, err := bumpAlert(ctx, existingUUID, alert.Timestamp)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to save alert: %v", err)
+			}
+
+			if existing != nil {
+				if err := rdb.PExpire(ctx, fpKey, cfg.window).Err(); err != nil {
+					log.Println("Error extending fingerprint", alert.Fingerprint+":", err)
+				}
+				indexNewAlert(ctx, existing)
+
+				return existing, false, nil
+			}
+		}
+
+		// -------------------------------------------------------------
+		claim := func(tx *redis.Tx) error {
+
+			current, err := tx.Get(ctx, fpKey).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if current != existingUUID {
+				return redis.TxFailedErr
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, fpKey, alert.UUID, cfg.window)
+				return nil
+			})
+			return err
+		}
+
+		err = rdb.Watch(ctx, claim, fpKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to save alert: %v", err)
+		}
+
+		if err := saveAlert(ctx, alert); err != nil {
+			return nil, false, err
+		}
+		if err := appendAlertStream(ctx, alert); err != nil {
+			return nil, false, err
+		}
+
+		return alert, true, nil
+	}
+
+	return nil, false, fmt.Errorf("failed to save alert: %v", redis.TxFailedErr)
+}
+
+// bumpAlert counts another occurrence of an unresolved alert. It returns
+// nil if the alert is gone or resolved.
+func bumpAlert(ctx context.Context, alertUUID string, seen int64) (*Alert, error) {
+
+	return updateAlert(ctx, alertUUID, func(alert *Alert) bool {
+		if alert.Status == StatusResolved {
+			return false
+		}
+		alert.Occurrences++
+		alert.LastSeen = seen
+		return true
+	})
+}
+
+func (a *Alert) fingerprint(fields []string) string {
+
+	h := sha256.New()
+
+	for _, field := range fields {
+
+		var value string
+
+		switch field {
+		case "title":
+			value = a.Title
+		case "body":
+			value = a.Body
+		case "source":
+			value = a.Source
+		case "severity":
+			value = a.Severity
+		case "rule":
+			value = a.Rule
+		case "tags":
+			tags := slices.Clone(a.Tags)
+			slices.Sort(tags)
+			value = strings.Join(tags, ",")
+		}
+
+		fmt.Fprintf(h, "%s=%q;", field, value)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func (a *Alert) firstSeen() int64 {
+	if a.FirstSeen > 0 {
+		return a.FirstSeen
+	}
+	return a.Timestamp
+}
+
+func (a *Alert) lastSeen() int64 {
+	if a.LastSeen > 0 {
+		return a.LastSeen
+	}
+	return a.Timestamp
+}
+
+func (g *AlertGroup) add(alert *Alert) {
+
+	occurrences := alert.Occurrences
+	if occurrences == 0 {
+		occurrences = 1
+	}
+
+	g.Alerts++
+	g.Occurrences += occurrences
+
+	if alert.Status != StatusResolved {
+		g.Open++
+	}
+	if slices.Index(Severities, alert.Severity) > slices.Index(Severities, g.Severity) {
+		g.Severity = alert.Severity
+	}
+	if first := alert.firstSeen(); first < g.FirstSeen {
+		g.FirstSeen = first
+	}
+	if last := alert.lastSeen(); last >= g.LastSeen {
+		g.LastSeen = last
+		g.Latest = alert.UUID
+		g.Title, g.Source, g.Tags = alert.Title, alert.Source, alert.Tags
+	}
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const idempotencyPrefix = "idempotency:"
+
+// IdempotentResponse is what a create endpoint answered the first time a
+// given Idempotency-Key was used. Pending is set while that first request
+// is still being handled.
+type IdempotentResponse struct {
+	BodyHash string              `json:"body_hash"`
+	Pending  bool                `json:"pending"`
+	Status   int                 `json:"status"`
+	Header   map[string][]string `json:"header,omitempty"`
+	Body     []byte              `json:"body"`
+}
+
+// ReserveIdempotencyKey claims key for a new request for as long as lease,
+// which should cover the request's deadline, so a reservation left behind
+// by a crashed instance soon frees up. If the key was already claimed it
+// returns the stored record and false instead.
+func ReserveIdempotencyKey(ctx context.Context, key, bodyHash string, lease time.Duration) (*IdempotentResponse, bool, error) {
+
+	pending, _ := json.Marshal(IdempotentResponse{BodyHash: bodyHash, Pending: true})
+
+	ok, err := rdb.SetNX(ctx, idempotencyPrefix+key, pending, lease).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %v", err)
+	}
+	if ok {
+		return nil, true, nil
+	}
+
+	stored, err := rdb.Get(ctx, idempotencyPrefix+key).Bytes()
+	if err == redis.Nil {
+		// Expired between the two calls; try again from the top.
+		return ReserveIdempotencyKey(ctx, key, bodyHash, lease)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency key: %v", err)
+	}
+
+	var resp IdempotentResponse
+	if err := json.Unmarshal(stored, &resp); err != nil {
+		return nil, false, fmt.Errorf("failed to deserialize idempotency key: %v", err)
+	}
+
+	return &resp, false, nil
+}
+
+// SaveIdempotentResponse replaces a reservation with the response it
+// produced, kept for ttl.
+func SaveIdempotentResponse(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to serialize response: %v", err)
+	}
+
+	if err := rdb.Set(ctx, idempotencyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotent response: %v", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a reservation so the request can be retried.
+func ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return rdb.Del(ctx, idempotencyPrefix+key).Err()
+}
@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Before hash tags, alerts lived under their bare UUID.
+const (
+	keyLayoutKey     = "meta:key_layout"
+	keyLayoutVersion = 2
+
+	legacyAlertKeyPattern = "????????-????-????-????-????????????"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// migrateKeyLayout renames alerts saved under their bare UUID to their
+// tagged names, once. Only a standalone or Sentinel deployment can have
+// any: a Cluster one starts on the tagged layout, and couldn't rename
+// across slots anyway. Keys whose new name is already taken are left
+// alone.
+func migrateKeyLayout(ctx context.Context, mode string) error {
+
+	if mode == ModeCluster {
+		return nil
+	}
+
+	version, err := rdb.Get(ctx, keyLayoutKey).Int()
+	if err == nil && version >= keyLayoutVersion {
+		return nil
+	}
+
+	// -------------------------------------------------------------
+	iter := rdb.Scan(ctx, 0, legacyAlertKeyPattern, 100).Iterator()
+
+	for iter.Next(ctx) {
+
+		alertUUID := iter.Val()
+
+		if err := renameLegacyKey(ctx, alertUUID, alertKey(alertUUID)); err != nil {
+			return err
+		}
+		if err := rdb.SAdd(ctx, allAlertsKey, alertUUID).Err(); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	// -------------------------------------------------------------
+	return rdb.Set(ctx, keyLayoutKey, keyLayoutVersion, 0).Err()
+}
+
+func renameLegacyKey(ctx context.Context, from, to string) error {
+
+	renamed, err := rdb.RenameNX(ctx, from, to).Result()
+	if err != nil {
+		// Gone since the scan found it, or never there.
+		if strings.Contains(err.Error(), "no such key") {
+			return nil
+		}
+		return err
+	}
+
+	if !renamed {
+		log.Printf("Not migrating Redis key %s: %s already exists", from, to)
+	}
+
+	return nil
+}
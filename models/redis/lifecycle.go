@@ -0,0 +1,296 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+
+	statusIndexPrefix   = alertIndexTag + ":status:"
+	severityIndexPrefix = alertIndexTag + ":severity:"
+
+	maxTransitionRetries = 5
+)
+
+var (
+	Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+	Statuses   = []string{StatusOpen, StatusAcknowledged, StatusResolved}
+
+	ErrAlertNotFound     = errors.New("alert not found")
+	ErrInvalidTransition = errors.New("invalid alert status transition")
+)
+
+func validSeverity(severity string) bool {
+	return slices.Contains(Severities, severity)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// AcknowledgeAlert moves an open alert to acknowledged.
+func AcknowledgeAlert(r *http.Request) (*Alert, error) {
+
+	return transition(r.Context(), r.PathValue("uuid"), StatusAcknowledged, func(alert *Alert, by string, at int64) {
+		alert.AcknowledgedBy = by
+		alert.AcknowledgedAt = at
+	}, StatusOpen)
+}
+
+// ResolveAlert moves an open or acknowledged alert to resolved.
+func ResolveAlert(r *http.Request) (*Alert, error) {
+
+	return transition(r.Context(), r.PathValue("uuid"), StatusResolved, func(alert *Alert, by string, at int64) {
+		alert.ResolvedBy = by
+		alert.ResolvedAt = at
+	}, StatusOpen, StatusAcknowledged)
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// transition changes an alert's status, retrying if the alert changes
+// underneath it, and then moves it between the status indexes.
+func transition(ctx context.Context, alertUUID, to string, stamp func(*Alert, string, int64), from ...string) (*Alert, error) {
+
+	var before, after Alert
+
+	update := func(tx *redis.Tx) error {
+
+		alertJSON, err := tx.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			return ErrAlertNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get alert: %v", err)
+		}
+		if err := json.Unmarshal([]byte(alertJSON), &before); err != nil {
+			return fmt.Errorf("failed to deserialize alert: %v", err)
+		}
+
+		if !slices.Contains(from, before.Status) {
+			return fmt.Errorf("%w: alert is %s", ErrInvalidTransition, before.Status)
+		}
+
+		after = before
+		after.Status = to
+		stamp(&after, postgres.Actor(ctx), time.Now().Unix())
+
+		updated, err := json.Marshal(after)
+		if err != nil {
+			return fmt.Errorf("failed to serialize alert: %v", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, alertKey(alertUUID), updated, 0)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxTransitionRetries; i++ {
+		if err = rdb.Watch(ctx, update, alertKey(alertUUID)); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, statusIndexPrefix+before.Status, alertUUID)
+		pipe.SAdd(ctx, statusIndexPrefix+to, alertUUID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert index: %v", err)
+	}
+
+	if err := postgres.RecordAudit(ctx, "alerts", alertUUID, to, before, after); err != nil {
+		log.Println("Error auditing alert", alertUUID+":", err)
+	}
+
+	return &after, nil
+}
+
+// updateAlert applies change to a stored alert, retrying if the alert
+// changes underneath it. It returns the updated alert, or nil if the
+// alert is gone or change declined to update it. Changes must leave the
+// alert's status and severity alone, as the indexes aren't touched.
+func updateAlert(ctx context.Context, alertUUID string, change func(*Alert) bool) (*Alert, error) {
+
+	var updated *Alert
+
+	update := func(tx *redis.Tx) error {
+
+		updated = nil
+
+		alertJSON, err := tx.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return fmt.Errorf("failed to deserialize alert: %v", err)
+		}
+		if !change(&alert) {
+			return nil
+		}
+
+		changed, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, alertKey(alertUUID), changed, 0)
+			return nil
+		})
+		if err == nil {
+			updated = &alert
+		}
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxTransitionRetries; i++ {
+		if err = rdb.Watch(ctx, update, alertKey(alertUUID)); err != redis.TxFailedErr {
+			break
+		}
+	}
+
+	return updated, err
+}
+
+// saveAlert writes an alert and then adds it to the indexes.
+func saveAlert(ctx context.Context, alert *Alert) error {
+
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %v", err)
+	}
+
+	if err := rdb.Set(ctx, alertKey(alert.UUID), alertJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save alert: %v", err)
+	}
+
+	return indexSavedAlert(ctx, alert)
+}
+
+// indexSavedAlert adds a saved alert to the status and severity indexes
+// and to the search index, each in a MULTI of its own. Both are sets, so
+// doing it again is harmless.
+func indexSavedAlert(ctx context.Context, alert *Alert) error {
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, allAlertsKey, alert.UUID)
+		pipe.SAdd(ctx, statusIndexPrefix+alert.Status, alert.UUID)
+		pipe.SAdd(ctx, severityIndexPrefix+alert.Severity, alert.UUID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index alert: %v", err)
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		indexAlert(ctx, pipe, alert)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index alert: %v", err)
+	}
+
+	return nil
+}
+
+// alertUUIDs returns the UUIDs of alerts with the given status and
+// severity, either of which may be empty to mean any.
+func alertUUIDs(ctx context.Context, status, severity string) ([]string, error) {
+
+	var indexes []string
+
+	if status != "" {
+		if !slices.Contains(Statuses, status) {
+			return nil, fmt.Errorf("invalid [status]")
+		}
+		indexes = append(indexes, statusIndexPrefix+status)
+	}
+	if severity != "" {
+		if !validSeverity(severity) {
+			return nil, fmt.Errorf("invalid [severity]")
+		}
+		indexes = append(indexes, severityIndexPrefix+severity)
+	}
+
+	if len(indexes) == 0 {
+		indexes = append(indexes, allAlertsKey)
+	}
+
+	alertUUIDs, err := rdb.SInter(ctx, indexes...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert index: %v", err)
+	}
+
+	return alertUUIDs, nil
+}
+
+// indexLegacyAlerts gives alerts saved before statuses existed the
+// defaults and index entries new alerts get on creation.
+func indexLegacyAlerts(ctx context.Context) error {
+
+	iter := rdb.SScan(ctx, allAlertsKey, 0, "", 100).Iterator()
+
+	for iter.Next(ctx) {
+
+		alertJSON, err := rdb.Get(ctx, alertKey(iter.Val())).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return fmt.Errorf("failed to deserialize alert %s: %v", iter.Val(), err)
+		}
+		if alert.Status != "" {
+			continue
+		}
+
+		alert.Status = StatusOpen
+		alert.Severity = SeverityInfo
+		alert.Source = "api"
+
+		if err := saveAlert(ctx, &alert); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
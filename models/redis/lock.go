@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/leader"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// A lock and its fencing counter share a hash tag, the lock's name. The
+// counter is never deleted, so tokens keep rising across holders.
+const lockPrefix = "locks:"
+
+// Takes the lock if it's free and hands out the next fencing token.
+var acquireLock = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+
+return 0
+`)
+
+// Extends the lock's TTL, or with no TTL deletes it, if it is still
+// held by the same owner.
+var renewLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+
+if ARGV[2] == '0' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+
+return 1
+`)
+
+type redisLocker struct{}
+
+type redisLease struct {
+	key   string
+	owner string
+	fence int64
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func (redisLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (leader.Lease, error) {
+
+	key := lockPrefix + "{" + name + "}"
+	owner := uuid.New().String()
+
+	fence, err := acquireLock.Run(ctx, rdb, []string{key, key + ":fence"}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %v", err)
+	}
+	if fence == 0 {
+		return nil, leader.ErrHeld
+	}
+
+	return &redisLease{key: key, owner: owner, fence: fence}, nil
+}
+
+func (l *redisLease) Fence() int64 {
+	return l.fence
+}
+
+func (l *redisLease) Refresh(ctx context.Context, ttl time.Duration) error {
+	return l.renew(ctx, max(ttl.Milliseconds(), 1))
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	return l.renew(ctx, 0)
+}
+
+func (l *redisLease) renew(ctx context.Context, ttlMs int64) error {
+
+	ok, err := renewLock.Run(ctx, rdb, []string{l.key}, l.owner, ttlMs).Int()
+	if err != nil {
+		return fmt.Errorf("failed to renew lock: %v", err)
+	}
+	if ok == 0 {
+		return leader.ErrLost
+	}
+
+	return nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// fencedTxPipelined runs fn's commands in one MULTI, unless a later holder
+// of fence's lock has already written under tag, in which case it fails
+// with leader.ErrStaleFence. The highest accepted token is kept under tag
+// so the check and the writes land in the same slot.
+func fencedTxPipelined(ctx context.Context, tag string, fence leader.Fence, fn func(redis.Pipeliner) error) error {
+
+	if fence.Token == 0 {
+		_, err := rdb.TxPipelined(ctx, fn)
+		return err
+	}
+
+	key := tag + ":fence:" + fence.Lock
+
+	write := func(tx *redis.Tx) error {
+
+		last, err := tx.Get(ctx, key).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if last > fence.Token {
+			return leader.ErrStaleFence
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, fence.Token, 0)
+			return fn(pipe)
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxTransitionRetries; i++ {
+		if err = rdb.Watch(ctx, write, key); err != redis.TxFailedErr {
+			break
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const rateLimitPrefix = "ratelimit:"
+
+// Refills the bucket for the time since it was last touched, then tries to
+// take one token. Redis' own clock is used so every instance agrees.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+
+return {allowed, tostring(tokens)}
+`)
+
+// TakeToken draws one token from the bucket at key. ratePerMs is the refill
+// rate in tokens per millisecond. It returns whether the token was granted
+// and how many tokens are left.
+func TakeToken(ctx context.Context, key string, capacity, ratePerMs float64) (bool, float64, error) {
+
+	res, err := tokenBucket.Run(ctx, rdb, []string{rateLimitPrefix + key},
+		capacity, strconv.FormatFloat(ratePerMs, 'f', -1, 64)).Slice()
+
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take token: %v", err)
+	}
+
+	allowed, _ := res[0].(int64)
+	tokens, err := strconv.ParseFloat(res[1].(string), 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to parse token count: %v", err)
+	}
+
+	return allowed == 1, tokens, nil
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/leader"
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// PurgeResolvedAlerts deletes alerts resolved before cutoff along with
+// their index and search entries, and returns how many it deleted.
+// Unresolved alerts are kept however old they are. It stops as soon as
+// fence has been superseded.
+func PurgeResolvedAlerts(ctx context.Context, cutoff time.Time, fence leader.Fence) (int, error) {
+
+	purged := 0
+
+	iter := rdb.SScan(ctx, statusIndexPrefix+StatusResolved, 0, "", 100).Iterator()
+
+	for iter.Next(ctx) {
+
+		alertUUID := iter.Val()
+
+		alertJSON, err := rdb.Get(ctx, alertKey(alertUUID)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("failed to get alert: %v", err)
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return purged, fmt.Errorf("failed to deserialize alert: %v", err)
+		}
+		if alert.Status != StatusResolved || alert.ResolvedAt >= cutoff.Unix() {
+			continue
+		}
+
+		// -------------------------------------------------------------
+		// The fence is checked in the indexes' slot, so a superseded run
+		// stops before it has touched anything.
+		err = fencedTxPipelined(ctx, alertIndexTag, fence, func(pipe redis.Pipeliner) error {
+			pipe.SRem(ctx, allAlertsKey, alertUUID)
+			pipe.SRem(ctx, statusIndexPrefix+alert.Status, alertUUID)
+			pipe.SRem(ctx, severityIndexPrefix+alert.Severity, alertUUID)
+			return nil
+		})
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge alert: %w", err)
+		}
+
+		if err := rdb.Del(ctx, alertKey(alertUUID)).Err(); err != nil {
+			return purged, fmt.Errorf("failed to purge alert: %v", err)
+		}
+
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			unindexAlertText(ctx, pipe, &alert)
+			return nil
+		})
+		if err != nil {
+			log.Println("Error unindexing alert", alertUUID+":", err)
+		}
+
+		purged++
+
+		// Like a user purge, the entry records no field values.
+		if err := postgres.RecordAudit(ctx, "alerts", alertUUID, "purge", nil, nil); err != nil {
+			log.Println("Error auditing alert", alertUUID+":", err)
+		}
+	}
+
+	return purged, iter.Err()
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const ruleWindowPrefix = "rules:window:"
+
+// Adds a txn to a rule's sliding window and drops those that have aged
+// out. Once the window holds more than the threshold it is emptied and
+// its txns returned, so each burst fires the rule once.
+var ruleWindow = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local threshold = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+
+if redis.call('ZCARD', KEYS[1]) > threshold then
+	local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+	redis.call('DEL', KEYS[1])
+	return members
+end
+
+redis.call('PEXPIRE', KEYS[1], window)
+return {}
+`)
+
+// ObserveRuleMatch counts a txn matching a threshold rule. When that
+// pushes the rule over its threshold it returns every txn in the window.
+func ObserveRuleMatch(ctx context.Context, ruleUUID, txnUUID string, window time.Duration, threshold int) ([]string, error) {
+
+	fired, err := ruleWindow.Run(ctx, rdb, []string{ruleWindowPrefix + ruleUUID},
+		window.Milliseconds(), threshold, txnUUID).StringSlice()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rule window: %v", err)
+	}
+
+	return fired, nil
+}
+
+// RaiseAlert saves an alert generated by the server rather than a client.
+// Severity defaults to warning.
+func RaiseAlert(ctx context.Context, alert *Alert) error {
+
+	alert.UUID = uuid.New().String()
+	alert.Timestamp = time.Now().Unix()
+	alert.Status = StatusOpen
+
+	if alert.Severity == "" {
+		alert.Severity = SeverityWarning
+	}
+
+	saved, created, err := saveOrCollapse(ctx, alert)
+	if err != nil || !created {
+		return err
+	}
+
+	enqueueWebhooks(ctx, saved)
+
+	return postgres.RecordAudit(ctx, "alerts", saved.UUID, "create", nil, saved)
+}
@@ -0,0 +1,468 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// The search index is an inverted index over alert titles and bodies: a
+// set of alert UUIDs per token, a lexically sorted set of every token for
+// prefix lookups, and a sorted set of alerts by last-seen time for
+// ranking. Its keys share a hash tag of their own, so token sets can be
+// intersected under Cluster.
+const (
+	searchTag         = "{alert-search}"
+	searchTokenPrefix = searchTag + ":token:"
+	searchTermsKey    = searchTag + ":terms"
+	searchRecencyKey  = searchTag + ":recency"
+
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+	maxPrefixTerms     = 200
+	searchBatchSize    = 100
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+// searchQuery is a disjunction of conjunctions: "a b OR c" is (a AND b)
+// OR c. AND binds tighter than OR, and juxtaposition means AND.
+type searchQuery [][]searchTerm
+
+// searchTerm is a single word, a prefix ("deploy*") or a quoted phrase.
+type searchTerm struct {
+	tokens []string
+	prefix bool
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// SearchAlerts finds alerts whose title or body match the q query
+// parameter, most recently seen first. Queries combine words, prefixes
+// ("pay*"), quoted phrases and the AND / OR operators.
+func SearchAlerts(r *http.Request) (*[]Alert, error) {
+
+	ctx := r.Context()
+
+	query, err := parseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultSearchLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return nil, fmt.Errorf("%w: invalid [limit]: must be 1-%d", ErrInvalidSearch, maxSearchLimit)
+		}
+		limit = n
+	}
+
+	// -------------------------------------------------------------
+	candidates, err := query.candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked, err := rankByRecency(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	// -------------------------------------------------------------
+	// The sets only say every token occurs somewhere; phrases still have
+	// to be checked against the text itself.
+	matched := []Alert{}
+
+	for start := 0; start < len(ranked) && len(matched) < limit; start += searchBatchSize {
+
+		batch := ranked[start:min(start+searchBatchSize, len(ranked))]
+
+		// Each alert is in a slot of its own, so they're pipelined
+		// rather than read with one MGET.
+		cmds := make([]*redis.StringCmd, len(batch))
+
+		_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, alertUUID := range batch {
+				cmds[i] = pipe.Get(ctx, alertKey(alertUUID))
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get alerts: %v", err)
+		}
+
+		for i, cmd := range cmds {
+
+			alertJSON, err := cmd.Result()
+			if err == redis.Nil {
+				// Gone since it was indexed.
+				unindexAlert(ctx, batch[i])
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get alert: %v", err)
+			}
+
+			var alert Alert
+			if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+				return nil, fmt.Errorf("failed to deserialize alert: %v", err)
+			}
+
+			if query.matches(searchTokens(alert.Title + " " + alert.Body)) {
+				matched = append(matched, alert)
+				if len(matched) == limit {
+					break
+				}
+			}
+		}
+	}
+
+	return &matched, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// indexAlert queues the search index writes for alert on pipe.
+func indexAlert(ctx context.Context, pipe redis.Pipeliner, alert *Alert) {
+
+	for _, token := range uniqueTokens(alert.Title + " " + alert.Body) {
+		pipe.SAdd(ctx, searchTokenPrefix+token, alert.UUID)
+		pipe.ZAdd(ctx, searchTermsKey, redis.Z{Member: token})
+	}
+
+	pipe.ZAdd(ctx, searchRecencyKey, redis.Z{Score: float64(alert.lastSeen()), Member: alert.UUID})
+}
+
+// unindexAlertText queues the removal of alert from every index entry
+// indexAlert made for it.
+func unindexAlertText(ctx context.Context, pipe redis.Pipeliner, alert *Alert) {
+
+	for _, token := range uniqueTokens(alert.Title + " " + alert.Body) {
+		pipe.SRem(ctx, searchTokenPrefix+token, alert.UUID)
+	}
+
+	pipe.ZRem(ctx, searchRecencyKey, alert.UUID)
+}
+
+// indexNewAlert indexes an alert saved outside a pipeline. The alert
+// stands either way, so failures are only logged.
+func indexNewAlert(ctx context.Context, alert *Alert) {
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		indexAlert(ctx, pipe, alert)
+		return nil
+	})
+	if err != nil {
+		log.Println("Error indexing alert", alert.UUID+":", err)
+	}
+}
+
+// unindexAlert drops an alert that no longer exists from the ranking.
+// Its text is gone with it, so its token set entries stay behind; unranked
+// UUIDs are skipped by every search.
+func unindexAlert(ctx context.Context, alertUUID string) {
+	if err := rdb.ZRem(ctx, searchRecencyKey, alertUUID).Err(); err != nil {
+		log.Println("Error unindexing alert", alertUUID+":", err)
+	}
+}
+
+// indexSearchBackfill indexes every stored alert the first time the
+// search index is found empty.
+func indexSearchBackfill(ctx context.Context) error {
+
+	if n, err := rdb.Exists(ctx, searchRecencyKey).Result(); err != nil || n > 0 {
+		return err
+	}
+
+	iter := rdb.SScan(ctx, allAlertsKey, 0, "", 100).Iterator()
+
+	for iter.Next(ctx) {
+
+		alertJSON, err := rdb.Get(ctx, alertKey(iter.Val())).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return fmt.Errorf("failed to deserialize alert %s: %v", iter.Val(), err)
+		}
+
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			indexAlert(ctx, pipe, &alert)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
+}
+
+// rankByRecency orders alert UUIDs by last-seen time, newest first.
+// UUIDs without a score have been removed and are dropped.
+func rankByRecency(ctx context.Context, uuids map[string]struct{}) ([]string, error) {
+
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	members := make([]string, 0, len(uuids))
+	for id := range uuids {
+		members = append(members, id)
+	}
+
+	scores, err := rdb.ZMScore(ctx, searchRecencyKey, members...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank alerts: %v", err)
+	}
+
+	seen := make(map[string]float64, len(members))
+	ranked := make([]string, 0, len(members))
+
+	for i, id := range members {
+		if scores[i] == 0 {
+			continue
+		}
+		seen[id] = scores[i]
+		ranked = append(ranked, id)
+	}
+
+	slices.SortFunc(ranked, func(a, b string) int {
+		switch {
+		case seen[a] > seen[b]:
+			return -1
+		case seen[a] < seen[b]:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	return ranked, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func parseSearchQuery(q string) (searchQuery, error) {
+
+	var (
+		query  searchQuery
+		clause []searchTerm
+	)
+
+	closeClause := func() error {
+		if len(clause) == 0 {
+			return fmt.Errorf("%w: invalid [q]: OR needs a term on both sides", ErrInvalidSearch)
+		}
+		query = append(query, clause)
+		clause = nil
+		return nil
+	}
+
+	for rest := strings.TrimSpace(q); rest != ""; rest = strings.TrimSpace(rest) {
+
+		var word string
+
+		if rest[0] == '"' {
+
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: invalid [q]: unterminated phrase", ErrInvalidSearch)
+			}
+
+			if tokens := searchTokens(rest[1 : end+1]); len(tokens) > 0 {
+				clause = append(clause, searchTerm{tokens: tokens})
+			}
+			rest = rest[end+2:]
+			continue
+		}
+
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word, rest = rest[:i], rest[i:]
+		} else {
+			word, rest = rest, ""
+		}
+
+		switch word {
+		case "AND":
+			continue
+		case "OR":
+			if err := closeClause(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		prefix := strings.HasSuffix(word, "*")
+
+		for _, token := range searchTokens(strings.TrimSuffix(word, "*")) {
+			clause = append(clause, searchTerm{tokens: []string{token}})
+		}
+
+		// "e-mail*" tokenizes to e, mail; the prefix applies to the last.
+		if prefix && len(clause) > 0 {
+			clause[len(clause)-1].prefix = true
+		}
+	}
+
+	if strings.TrimSpace(q) == "" {
+		return nil, fmt.Errorf("%w: invalid [q]: a query is required", ErrInvalidSearch)
+	}
+	if len(query) == 0 && len(clause) == 0 {
+		return nil, fmt.Errorf("%w: invalid [q]: no words to search for; only letters and digits are indexed", ErrInvalidSearch)
+	}
+	if err := closeClause(); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// candidates returns the alerts containing every token of some clause,
+// read from the token sets.
+func (q searchQuery) candidates(ctx context.Context) (map[string]struct{}, error) {
+
+	union := map[string]struct{}{}
+
+	for _, clause := range q {
+
+		var inClause map[string]struct{}
+
+		for _, term := range clause {
+
+			keys, err := term.keys(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			var members []string
+			if len(keys) > 0 {
+				if term.prefix {
+					members, err = rdb.SUnion(ctx, keys...).Result()
+				} else {
+					members, err = rdb.SInter(ctx, keys...).Result()
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to read search index: %v", err)
+				}
+			}
+
+			found := make(map[string]struct{}, len(members))
+			for _, m := range members {
+				if inClause == nil {
+					found[m] = struct{}{}
+				} else if _, ok := inClause[m]; ok {
+					found[m] = struct{}{}
+				}
+			}
+			inClause = found
+
+			if len(inClause) == 0 {
+				break
+			}
+		}
+
+		for id := range inClause {
+			union[id] = struct{}{}
+		}
+	}
+
+	return union, nil
+}
+
+// keys returns the token sets a term draws from: one per token of a word
+// or phrase, or one per indexed token starting with a prefix. A prefix
+// matching more than maxPrefixTerms tokens is refused rather than
+// silently cut short.
+func (t searchTerm) keys(ctx context.Context) ([]string, error) {
+
+	if !t.prefix {
+		keys := make([]string, len(t.tokens))
+		for i, token := range t.tokens {
+			keys[i] = searchTokenPrefix + token
+		}
+		return keys, nil
+	}
+
+	terms, err := rdb.ZRangeByLex(ctx, searchTermsKey, &redis.ZRangeBy{
+		Min:   "[" + t.tokens[0],
+		Max:   "[" + t.tokens[0] + "\xff",
+		Count: maxPrefixTerms + 1,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand prefix: %v", err)
+	}
+	if len(terms) > maxPrefixTerms {
+		return nil, fmt.Errorf("%w: invalid [q]: prefix %q is too broad, matching over %d words", ErrInvalidSearch, t.tokens[0]+"*", maxPrefixTerms)
+	}
+
+	keys := make([]string, len(terms))
+	for i, term := range terms {
+		keys[i] = searchTokenPrefix + term
+	}
+
+	return keys, nil
+}
+
+// matches checks the query against a text's tokens, in order.
+func (q searchQuery) matches(tokens []string) bool {
+
+	for _, clause := range q {
+		if slices.IndexFunc(clause, func(t searchTerm) bool { return !t.matches(tokens) }) < 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t searchTerm) matches(tokens []string) bool {
+
+	if t.prefix {
+		return slices.ContainsFunc(tokens, func(token string) bool {
+			return strings.HasPrefix(token, t.tokens[0])
+		})
+	}
+
+	for i := 0; i+len(t.tokens) <= len(tokens); i++ {
+		if slices.Equal(tokens[i:i+len(t.tokens)], t.tokens) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// searchTokens lowercases text and splits it into runs of letters and
+// digits, in order.
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func uniqueTokens(text string) []string {
+	tokens := searchTokens(text)
+	slices.Sort(tokens)
+	return slices.Compact(tokens)
+}
@@ -0,0 +1,495 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/leader"
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Silences are kept in a hash by UUID, beside a sorted set of their end
+// times, so matching only reads the silences still in effect and ended
+// ones can be pruned. Both share a hash tag, for the MULTI blocks that
+// write them together.
+const (
+	silencesTag    = "{silences}"
+	silencesKey    = silencesTag + ":all"
+	silencesEndKey = silencesTag + ":ends_at"
+
+	silencePruneBatch = 100
+)
+
+// A silence's matchers never change, so they're compiled once and kept
+// while the silence is in effect.
+var (
+	compiledMu sync.Mutex
+	compiled   = map[string][]Matcher{}
+)
+
+var (
+	silenceableFields = []string{"title", "body", "source", "severity", "tags", "rule", "fingerprint"}
+
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrInvalidSilence  = errors.New("invalid silence")
+)
+
+// Silence mutes alerts matching every one of its matchers between
+// StartsAt and EndsAt (unix seconds). Matching alerts are still stored,
+// marked as silenced, but no notifications go out for them.
+type Silence struct {
+	UUID      string    `json:"uuid"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  int64     `json:"starts_at"`
+	EndsAt    int64     `json:"ends_at"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt int64     `json:"created_at"`
+}
+
+// Matcher compares one alert field with Value, exactly or, with Regex, as
+// a fully anchored regular expression. For tags, any one tag matching is
+// enough.
+type Matcher struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Regex bool   `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func CreateSilence(r *http.Request) (*Silence, error) {
+
+	silence, err := parseSilence(r)
+	if err != nil {
+		return nil, err
+	}
+
+	silence.UUID = uuid.New().String()
+	silence.CreatedBy = postgres.Actor(r.Context())
+	silence.CreatedAt = time.Now().Unix()
+
+	// -------------------------------------------------------------
+	if err := saveSilence(r.Context(), silence); err != nil {
+		return nil, err
+	}
+
+	if err := postgres.RecordAudit(r.Context(), "silences", silence.UUID, "create", nil, silence); err != nil {
+		log.Println("Error auditing silence", silence.UUID+":", err)
+	}
+
+	// New alerts are marked as they're saved; those already unresolved
+	// are marked now.
+	if silence.activeAt(time.Now().Unix()) {
+		if err := markSilenced(r.Context(), silence); err != nil {
+			log.Println("Error applying silence", silence.UUID+":", err)
+		}
+	}
+
+	return silence, nil
+}
+
+// GetAllSilences lists silences, newest first; only those in effect now
+// when the active query parameter is "true". Ended silences are listed
+// until the silence-prune job removes them.
+func GetAllSilences(r *http.Request) (*[]Silence, error) {
+
+	var silences []Silence
+	var err error
+
+	if r.URL.Query().Get("active") == "true" {
+		silences, err = loadSilences(r.Context())
+	} else {
+		silences, err = allSilences(r.Context())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(silences, func(a, b Silence) int {
+		return int(b.CreatedAt - a.CreatedAt)
+	})
+
+	return &silences, nil
+}
+
+// ExpireSilence ends a silence now instead of at its scheduled end.
+func ExpireSilence(r *http.Request) (*Silence, error) {
+
+	ctx := r.Context()
+	silenceUUID := r.PathValue("uuid")
+
+	silenceJSON, err := rdb.HGet(ctx, silencesKey, silenceUUID).Result()
+	if err == redis.Nil {
+		return nil, ErrSilenceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get silence: %v", err)
+	}
+
+	var before, after Silence
+	if err := json.Unmarshal([]byte(silenceJSON), &before); err != nil {
+		return nil, fmt.Errorf("failed to deserialize silence: %v", err)
+	}
+
+	after = before
+	if now := time.Now().Unix(); after.EndsAt > now {
+		after.EndsAt = now
+	}
+
+	if err := saveSilence(ctx, &after); err != nil {
+		return nil, err
+	}
+
+	if err := postgres.RecordAudit(ctx, "silences", silenceUUID, "expire", before, after); err != nil {
+		log.Println("Error auditing silence", silenceUUID+":", err)
+	}
+
+	return &after, nil
+}
+
+// PreviewSilence returns the unresolved alerts a silence, given in the
+// request body but not saved, would match.
+func PreviewSilence(r *http.Request) (*[]Alert, error) {
+
+	ctx := r.Context()
+
+	silence, err := parseSilence(r)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := matchingAlerts(ctx, silence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &matched, nil
+}
+
+// PruneSilences deletes silences that ended before cutoff and returns how
+// many it deleted. It stops as soon as fence has been superseded.
+func PruneSilences(ctx context.Context, cutoff time.Time, fence leader.Fence) (int, error) {
+
+	pruned := 0
+
+	for {
+		ended, err := rdb.ZRangeByScore(ctx, silencesEndKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   "(" + strconv.FormatInt(cutoff.Unix(), 10),
+			Count: silencePruneBatch,
+		}).Result()
+		if err != nil {
+			return pruned, fmt.Errorf("failed to read silences: %v", err)
+		}
+		if len(ended) == 0 {
+			return pruned, nil
+		}
+
+		err = fencedTxPipelined(ctx, silencesTag, fence, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, silencesKey, ended...)
+			pipe.ZRem(ctx, silencesEndKey, ended)
+			return nil
+		})
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune silences: %w", err)
+		}
+
+		pruned += len(ended)
+	}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// applySilences marks alert with every silence in effect that matches it.
+// If silences can't be read the alert goes out unsilenced: a missed
+// mute is better than a missed page.
+func applySilences(ctx context.Context, alert *Alert) {
+
+	silences, err := loadSilences(ctx)
+	if err != nil {
+		log.Println("Error loading silences:", err)
+		return
+	}
+
+	now := time.Now().Unix()
+
+	for i := range silences {
+		if silences[i].activeAt(now) && silences[i].matches(alert) {
+			alert.SilencedBy = append(alert.SilencedBy, silences[i].UUID)
+		}
+	}
+}
+
+// matchingAlerts returns the unresolved alerts silence matches.
+func matchingAlerts(ctx context.Context, silence *Silence) ([]Alert, error) {
+
+	matched := []Alert{}
+
+	for _, status := range []string{StatusOpen, StatusAcknowledged} {
+
+		alertUUIDs, err := alertUUIDs(ctx, status, "")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alertUUID := range alertUUIDs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			alertJSON, err := rdb.Get(ctx, alertKey(alertUUID)).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get alert: %v", err)
+			}
+
+			var alert Alert
+			if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+				return nil, fmt.Errorf("failed to deserialize alert: %v", err)
+			}
+
+			if silence.matches(&alert) {
+				matched = append(matched, alert)
+			}
+		}
+	}
+
+	return matched, nil
+}
+
+// markSilenced adds silence to the SilencedBy of every unresolved alert
+// it matches.
+func markSilenced(ctx context.Context, silence *Silence) error {
+
+	matched, err := matchingAlerts(ctx, silence)
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range matched {
+
+		_, err := updateAlert(ctx, alert.UUID, func(alert *Alert) bool {
+			if alert.Status == StatusResolved || slices.Contains(alert.SilencedBy, silence.UUID) {
+				return false
+			}
+			alert.SilencedBy = append(alert.SilencedBy, silence.UUID)
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark alert %s: %v", alert.UUID, err)
+		}
+	}
+
+	return nil
+}
+
+// saveSilence writes a silence and its end time together.
+func saveSilence(ctx context.Context, silence *Silence) error {
+
+	silenceJSON, err := json.Marshal(silence)
+	if err != nil {
+		return fmt.Errorf("failed to serialize silence: %v", err)
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, silencesKey, silence.UUID, silenceJSON)
+		pipe.ZAdd(ctx, silencesEndKey, redis.Z{Score: float64(silence.EndsAt), Member: silence.UUID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save silence: %v", err)
+	}
+
+	return nil
+}
+
+func parseSilence(r *http.Request) (*Silence, error) {
+
+	var requestBody Silence
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		return nil, fmt.Errorf("%w: invalid request body: %v", ErrInvalidSilence, err)
+	}
+
+	if len(requestBody.Matchers) == 0 {
+		return nil, fmt.Errorf("%w: invalid [matchers]: at least one is required", ErrInvalidSilence)
+	}
+	if err := requestBody.compile(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+	}
+
+	if requestBody.StartsAt == 0 {
+		requestBody.StartsAt = time.Now().Unix()
+	}
+	if requestBody.EndsAt <= requestBody.StartsAt {
+		return nil, fmt.Errorf("%w: invalid [ends_at]: must be after [starts_at]", ErrInvalidSilence)
+	}
+
+	return &requestBody, nil
+}
+
+// loadSilences returns the silences that haven't ended yet, matchers
+// compiled. Some may not have started.
+func loadSilences(ctx context.Context) ([]Silence, error) {
+
+	current, err := rdb.ZRangeByScore(ctx, silencesEndKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch silences: %v", err)
+	}
+
+	var values []interface{}
+	if len(current) > 0 {
+		if values, err = rdb.HMGet(ctx, silencesKey, current...).Result(); err != nil {
+			return nil, fmt.Errorf("failed to fetch silences: %v", err)
+		}
+	}
+
+	// -------------------------------------------------------------
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+
+	silences := make([]Silence, 0, len(values))
+	stillCompiled := make(map[string][]Matcher, len(values))
+
+	for _, value := range values {
+
+		silenceJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var silence Silence
+		if err := json.Unmarshal([]byte(silenceJSON), &silence); err != nil {
+			return nil, fmt.Errorf("failed to deserialize silence: %v", err)
+		}
+
+		if matchers, ok := compiled[silence.UUID]; ok {
+			silence.Matchers = matchers
+		} else if err := silence.compile(); err != nil {
+			return nil, err
+		}
+
+		stillCompiled[silence.UUID] = silence.Matchers
+		silences = append(silences, silence)
+	}
+
+	compiled = stillCompiled
+
+	return silences, nil
+}
+
+// allSilences returns every stored silence, ended or not.
+func allSilences(ctx context.Context) ([]Silence, error) {
+
+	values, err := rdb.HVals(ctx, silencesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch silences: %v", err)
+	}
+
+	silences := make([]Silence, 0, len(values))
+
+	for _, value := range values {
+
+		var silence Silence
+		if err := json.Unmarshal([]byte(value), &silence); err != nil {
+			return nil, fmt.Errorf("failed to deserialize silence: %v", err)
+		}
+
+		silences = append(silences, silence)
+	}
+
+	return silences, nil
+}
+
+func (s *Silence) compile() error {
+
+	for i := range s.Matchers {
+
+		m := &s.Matchers[i]
+
+		if !slices.Contains(silenceableFields, m.Field) {
+			return fmt.Errorf("invalid matcher [field]: %q", m.Field)
+		}
+		if !m.Regex {
+			continue
+		}
+
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid matcher [value]: %v", err)
+		}
+		m.re = re
+	}
+
+	return nil
+}
+
+func (s *Silence) activeAt(now int64) bool {
+	return s.StartsAt <= now && now < s.EndsAt
+}
+
+func (s *Silence) matches(alert *Alert) bool {
+
+	for i := range s.Matchers {
+		if !s.Matchers[i].matches(alert) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *Matcher) matches(alert *Alert) bool {
+
+	var values []string
+
+	switch m.Field {
+	case "title":
+		values = []string{alert.Title}
+	case "body":
+		values = []string{alert.Body}
+	case "source":
+		values = []string{alert.Source}
+	case "severity":
+		values = []string{alert.Severity}
+	case "rule":
+		values = []string{alert.Rule}
+	case "fingerprint":
+		values = []string{alert.Fingerprint}
+	case "tags":
+		values = alert.Tags
+	}
+
+	for _, value := range values {
+		if m.re != nil && m.re.MatchString(value) || m.re == nil && m.Value == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const revokedTokenPrefix = "auth:revoked:"
+
+// RevokeToken blacklists a token ID until the token would have expired on
+// its own anyway, after which the entry cleans itself up.
+func RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := rdb.Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+
+	return nil
+}
+
+func IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+
+	n, err := rdb.Exists(ctx, revokedTokenPrefix+jti).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token: %v", err)
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/i101dev/multimodal-db/models/postgres"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Cached users are stored twice, by UUID and by name, under one hash tag
+// so the script that writes both works under Cluster.
+const (
+	userCacheTag    = "{users}"
+	userCachePrefix = userCacheTag + ":cache:"
+	userStalePrefix = userCacheTag + ":stale:"
+
+	// How long after an invalidation a user can't be cached again. It
+	// covers lookups that read the old row just before the change
+	// committed and would otherwise cache it just after.
+	userStaleWindow = 5 * time.Second
+)
+
+// Caches a user under both keys, unless it was invalidated within the
+// stale window.
+var cacheUser = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[2])
+
+return 1
+`)
+
+type userCache struct {
+	ttl time.Duration
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// StartUserCache puts a Redis read-through cache in front of Postgres
+// user lookups, with entries expiring after USER_CACHE_TTL. Without
+// USER_CACHE_TTL, or without Redis, there is no cache.
+func StartUserCache() {
+
+	ttl, err := time.ParseDuration(os.Getenv("USER_CACHE_TTL"))
+	if err != nil || ttl <= 0 || !Configured() {
+		return
+	}
+
+	ConnectDB()
+
+	postgres.SetUserCache(&userCache{ttl: ttl})
+}
+
+// Get treats any Redis error as a miss, so lookups fall back to Postgres
+// when Redis is unavailable.
+func (c *userCache) Get(ctx context.Context, column, value string) (*postgres.User, bool) {
+
+	userJSON, err := rdb.Get(ctx, userCachePrefix+column+":"+value).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Println("Error reading user cache:", err)
+		}
+		return nil, false
+	}
+
+	var u postgres.User
+	if err := json.Unmarshal(userJSON, &u); err != nil {
+		return nil, false
+	}
+
+	return &u, true
+}
+
+func (c *userCache) Set(ctx context.Context, u *postgres.User) {
+
+	userJSON, err := json.Marshal(u)
+	if err != nil {
+		return
+	}
+
+	err = cacheUser.Run(ctx, rdb, []string{
+		userCachePrefix + "uuid:" + u.UUID,
+		userCachePrefix + "name:" + u.Name,
+		userStalePrefix + u.UUID,
+	}, userJSON, c.ttl.Milliseconds()).Err()
+
+	if err != nil {
+		log.Println("Error writing user cache:", err)
+	}
+}
+
+// Invalidate drops users by UUID and name. If it fails the entries live
+// out their TTL.
+func (c *userCache) Invalidate(ctx context.Context, users ...*postgres.User) {
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, u := range users {
+			pipe.Set(ctx, userStalePrefix+u.UUID, 1, userStaleWindow)
+			pipe.Del(ctx, userCachePrefix+"uuid:"+u.UUID, userCachePrefix+"name:"+u.Name)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println("Error invalidating user cache:", err)
+	}
+}
@@ -0,0 +1,525 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Webhook keys share their own hash tag, for the claim script and the
+// MULTI blocks that move a delivery between the queue and the DLQ.
+const (
+	webhookTag = "{webhooks}"
+
+	webhookSubsKey      = webhookTag + ":subs"
+	webhookQueueKey     = webhookTag + ":queue"
+	webhookDeadKey      = webhookTag + ":dlq"
+	webhookDeadIndexKey = webhookTag + ":dlq:failed_at"
+	webhookLogKey       = webhookTag + ":log"
+	webhookDeliveryPref = webhookTag + ":delivery:"
+
+	webhookLogLen  = 1000
+	webhookDeadLen = 1000
+
+	EventAlertCreated = "alert.created"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// Webhook is a subscription to alerts at or above MinSeverity. Secret
+// signs every delivery and is only shown when the webhook is created.
+type Webhook struct {
+	UUID        string `json:"uuid"`
+	URL         string `json:"url"`
+	Secret      string `json:"secret,omitempty"`
+	MinSeverity string `json:"min_severity"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// WebhookDelivery is one alert on its way to one webhook.
+type WebhookDelivery struct {
+	ID          string `json:"id"`
+	WebhookUUID string `json:"webhook_uuid"`
+	AlertUUID   string `json:"alert_uuid"`
+	Event       string `json:"event"`
+	Payload     string `json:"payload"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"last_error,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// DeliveryAttempt is a delivery log entry.
+type DeliveryAttempt struct {
+	DeliveryID  string `json:"delivery_id"`
+	WebhookUUID string `json:"webhook_uuid"`
+	AlertUUID   string `json:"alert_uuid"`
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	Outcome     string `json:"outcome"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// Takes up to ARGV[2] deliveries that are due and pushes them ARGV[1]
+// milliseconds into the future, so a dispatcher that dies mid-delivery
+// only delays them.
+var claimDeliveries = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, tonumber(ARGV[2]))
+for _, id in ipairs(due) do
+	redis.call('ZADD', KEYS[1], now + tonumber(ARGV[1]), id)
+end
+
+return due
+`)
+
+// Drops the oldest dead letters beyond the newest ARGV[1].
+var trimDeadLetters = redis.NewScript(`
+local over = redis.call('ZCARD', KEYS[2]) - tonumber(ARGV[1])
+if over <= 0 then
+	return 0
+end
+
+local oldest = redis.call('ZRANGE', KEYS[2], 0, over - 1)
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, over - 1)
+redis.call('HDEL', KEYS[1], unpack(oldest))
+
+return over
+`)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func CreateWebhook(r *http.Request) (*Webhook, error) {
+
+	var requestBody Webhook
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	// -------------------------------------------------------------
+	target, err := url.Parse(requestBody.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid [url]")
+	}
+	if requestBody.MinSeverity == "" {
+		requestBody.MinSeverity = SeverityInfo
+	}
+	if !validSeverity(requestBody.MinSeverity) {
+		return nil, fmt.Errorf("invalid [min_severity]: must be info, warning or critical")
+	}
+	if requestBody.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		requestBody.Secret = hex.EncodeToString(secret)
+	}
+
+	requestBody.UUID = uuid.New().String()
+	requestBody.CreatedAt = time.Now().Unix()
+
+	// -------------------------------------------------------------
+	webhookJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize webhook: %v", err)
+	}
+
+	if err := rdb.HSet(r.Context(), webhookSubsKey, requestBody.UUID, webhookJSON).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %v", err)
+	}
+
+	return &requestBody, nil
+}
+
+func GetAllWebhooks(r *http.Request) (*[]Webhook, error) {
+
+	webhooks, err := loadWebhooks(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return &webhooks, nil
+}
+
+func DeleteWebhook(r *http.Request) error {
+
+	var requestBody struct {
+		UUID string `json:"uuid"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+
+	// Deliveries already queued are dropped when they come due.
+	removed, err := rdb.HDel(r.Context(), webhookSubsKey, requestBody.UUID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	if removed == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// GetWebhook returns a webhook including its secret, for signing.
+func GetWebhook(ctx context.Context, webhookUUID string) (*Webhook, error) {
+
+	webhookJSON, err := rdb.HGet(ctx, webhookSubsKey, webhookUUID).Result()
+	if err == redis.Nil {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %v", err)
+	}
+
+	var webhook Webhook
+	if err := json.Unmarshal([]byte(webhookJSON), &webhook); err != nil {
+		return nil, fmt.Errorf("failed to deserialize webhook: %v", err)
+	}
+
+	return &webhook, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// ClaimDeliveries takes up to limit due deliveries off the queue. Each is
+// hidden for lease; one that is neither completed, rescheduled nor
+// dead-lettered by then is handed out again.
+func ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+
+	ids, err := claimDeliveries.Run(ctx, rdb, []string{webhookQueueKey}, lease.Milliseconds(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = webhookDeliveryPref + id
+	}
+
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deliveries: %v", err)
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(ids))
+
+	for i, value := range values {
+
+		deliveryJSON, ok := value.(string)
+		if !ok {
+			rdb.ZRem(ctx, webhookQueueKey, ids[i])
+			continue
+		}
+
+		var delivery WebhookDelivery
+		if err := json.Unmarshal([]byte(deliveryJSON), &delivery); err != nil {
+			return nil, fmt.Errorf("failed to deserialize delivery: %v", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// CompleteDelivery removes a delivered (or undeliverable) delivery from
+// the queue and logs the attempt.
+func CompleteDelivery(ctx context.Context, delivery *WebhookDelivery, attempt DeliveryAttempt) error {
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, webhookQueueKey, delivery.ID)
+		pipe.Del(ctx, webhookDeliveryPref+delivery.ID)
+		logAttempt(ctx, pipe, attempt)
+		return nil
+	})
+
+	return err
+}
+
+// RetryDelivery reschedules a failed delivery for at and logs the attempt.
+func RetryDelivery(ctx context.Context, delivery *WebhookDelivery, at time.Time, attempt DeliveryAttempt) error {
+
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, webhookDeliveryPref+delivery.ID, deliveryJSON, 0)
+		pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(at.UnixMilli()), Member: delivery.ID})
+		logAttempt(ctx, pipe, attempt)
+		return nil
+	})
+
+	return err
+}
+
+// DeadLetterDelivery moves a delivery that has run out of attempts to the
+// dead letters and logs the attempt. Only the newest webhookDeadLen dead
+// letters are kept.
+func DeadLetterDelivery(ctx context.Context, delivery *WebhookDelivery, attempt DeliveryAttempt) error {
+
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, webhookQueueKey, delivery.ID)
+		pipe.Del(ctx, webhookDeliveryPref+delivery.ID)
+		pipe.HSet(ctx, webhookDeadKey, delivery.ID, deliveryJSON)
+		pipe.ZAdd(ctx, webhookDeadIndexKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: delivery.ID})
+		logAttempt(ctx, pipe, attempt)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Dropping the oldest can wait for the next dead letter if it fails.
+	if err := trimDeadLetters.Run(ctx, rdb, []string{webhookDeadKey, webhookDeadIndexKey}, webhookDeadLen).Err(); err != nil {
+		log.Println("Error trimming dead letters:", err)
+	}
+
+	return nil
+}
+
+// GetDeliveryLog returns the latest delivery attempts, newest first,
+// optionally only those for the webhook query parameter.
+func GetDeliveryLog(r *http.Request) (*[]DeliveryAttempt, error) {
+
+	entries, err := rdb.LRange(r.Context(), webhookLogKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery log: %v", err)
+	}
+
+	webhookUUID := r.URL.Query().Get("webhook")
+	attempts := []DeliveryAttempt{}
+
+	for _, entry := range entries {
+
+		var attempt DeliveryAttempt
+		if err := json.Unmarshal([]byte(entry), &attempt); err != nil {
+			continue
+		}
+		if webhookUUID != "" && attempt.WebhookUUID != webhookUUID {
+			continue
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	return &attempts, nil
+}
+
+// GetDeadLetters returns the dead letters, most recently failed first.
+func GetDeadLetters(r *http.Request) (*[]WebhookDelivery, error) {
+
+	ctx := r.Context()
+
+	ids, err := rdb.ZRevRange(ctx, webhookDeadIndexKey, 0, webhookDeadLen-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %v", err)
+	}
+
+	deliveries := []WebhookDelivery{}
+
+	if len(ids) == 0 {
+		return &deliveries, nil
+	}
+
+	values, err := rdb.HMGet(ctx, webhookDeadKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %v", err)
+	}
+
+	for _, value := range values {
+
+		deliveryJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var delivery WebhookDelivery
+		if err := json.Unmarshal([]byte(deliveryJSON), &delivery); err == nil {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return &deliveries, nil
+}
+
+// RetryDeadLetter puts a dead-lettered delivery back on the queue with
+// its attempts reset.
+func RetryDeadLetter(r *http.Request) (*WebhookDelivery, error) {
+
+	ctx := r.Context()
+
+	var requestBody struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	deliveryJSON, err := rdb.HGet(ctx, webhookDeadKey, requestBody.ID).Result()
+	if err == redis.Nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter: %v", err)
+	}
+
+	var delivery WebhookDelivery
+	if err := json.Unmarshal([]byte(deliveryJSON), &delivery); err != nil {
+		return nil, fmt.Errorf("failed to deserialize delivery: %v", err)
+	}
+
+	delivery.Attempts = 0
+	delivery.LastError = ""
+
+	requeued, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, webhookDeadKey, delivery.ID)
+		pipe.ZRem(ctx, webhookDeadIndexKey, delivery.ID)
+		pipe.Set(ctx, webhookDeliveryPref+delivery.ID, requeued, 0)
+		pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: delivery.ID})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue delivery: %v", err)
+	}
+
+	return &delivery, nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// enqueueWebhooks queues a new alert for every webhook whose severity
+// filter it passes, unless the alert is silenced. Failures are logged
+// rather than returned: the alert itself has been saved either way.
+func enqueueWebhooks(ctx context.Context, alert *Alert) {
+
+	if len(alert.SilencedBy) > 0 {
+		return
+	}
+
+	webhooks, err := loadWebhooks(ctx)
+	if err != nil {
+		log.Println("Error loading webhooks for alert", alert.UUID+":", err)
+		return
+	}
+
+	payload, err := json.Marshal(struct {
+		Event string `json:"event"`
+		Alert *Alert `json:"alert"`
+	}{EventAlertCreated, alert})
+	if err != nil {
+		log.Println("Error serializing webhook payload for alert", alert.UUID+":", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, webhook := range webhooks {
+
+		if slices.Index(Severities, alert.Severity) < slices.Index(Severities, webhook.MinSeverity) {
+			continue
+		}
+
+		delivery := WebhookDelivery{
+			ID:          uuid.New().String(),
+			WebhookUUID: webhook.UUID,
+			AlertUUID:   alert.UUID,
+			Event:       EventAlertCreated,
+			Payload:     string(payload),
+			CreatedAt:   now.Unix(),
+		}
+
+		deliveryJSON, err := json.Marshal(delivery)
+		if err != nil {
+			continue
+		}
+
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, webhookDeliveryPref+delivery.ID, deliveryJSON, 0)
+			pipe.ZAdd(ctx, webhookQueueKey, redis.Z{Score: float64(now.UnixMilli()), Member: delivery.ID})
+			return nil
+		})
+		if err != nil {
+			log.Println("Error queueing webhook delivery for alert", alert.UUID+":", err)
+		}
+	}
+}
+
+func loadWebhooks(ctx context.Context) ([]Webhook, error) {
+
+	values, err := rdb.HVals(ctx, webhookSubsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %v", err)
+	}
+
+	webhooks := make([]Webhook, 0, len(values))
+
+	for _, value := range values {
+		var webhook Webhook
+		if err := json.Unmarshal([]byte(value), &webhook); err != nil {
+			return nil, fmt.Errorf("failed to deserialize webhook: %v", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	slices.SortFunc(webhooks, func(a, b Webhook) int {
+		return int(a.CreatedAt - b.CreatedAt)
+	})
+
+	return webhooks, nil
+}
+
+func logAttempt(ctx context.Context, pipe redis.Pipeliner, attempt DeliveryAttempt) {
+
+	entry, err := json.Marshal(attempt)
+	if err != nil {
+		return
+	}
+
+	pipe.LPush(ctx, webhookLogKey, entry)
+	pipe.LTrim(ctx, webhookLogKey, 0, webhookLogLen-1)
+}
@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	badgerdb "github.com/i101dev/multimodal-db/models/badger"
+	"github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+)
+
+// StartRelay publishes user events from the Postgres outbox to Redis, when
+// it's configured, and the Badger ledger in the background. Every instance relays; rows are
+// locked as they're claimed. Published events are pruned by the
+// outbox-prune job.
+//
+//	OUTBOX_POLL_INTERVAL  how often to look for new events (default 1s)
+//	OUTBOX_BATCH_SIZE     events handled per poll (default 100)
+func StartRelay() {
+
+	postgres.ConnectDB()
+	badgerdb.ConnectDB()
+
+	if redisdb.Configured() {
+		redisdb.ConnectDB()
+	}
+
+	interval := util.EnvDuration("OUTBOX_POLL_INTERVAL", defaultPollInterval)
+
+	batch := defaultBatchSize
+	if n, err := strconv.Atoi(os.Getenv("OUTBOX_BATCH_SIZE")); err == nil && n > 0 {
+		batch = n
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+
+			// Keep draining while full batches come back.
+			for {
+				n, err := postgres.ProcessOutbox(context.Background(), batch, publish)
+				if err != nil {
+					log.Println("Error relaying outbox:", err)
+				}
+				if err != nil || n < batch {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// publish delivers one event to every store. Each store dedups by event
+// ID, so a retry after a partial failure only fills in what's missing.
+func publish(ctx context.Context, ev *postgres.OutboxEvent) error {
+
+	if redisdb.Enabled() {
+		if _, err := redisdb.PublishEvent(ctx, ev); err != nil {
+			return err
+		}
+	}
+
+	if _, err := badgerdb.AppendLedger(ctx, ev); err != nil {
+		return err
+	}
+
+	return nil
+}
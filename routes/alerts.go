@@ -3,6 +3,9 @@ package routes
 import (
 	"net/http"
 
+	"github.com/i101dev/multimodal-db/auth"
+	"github.com/i101dev/multimodal-db/middleware"
+	"github.com/i101dev/multimodal-db/models/postgres"
 	"github.com/i101dev/multimodal-db/util"
 
 	database "github.com/i101dev/multimodal-db/models/redis"
@@ -11,10 +14,21 @@ import (
 func RegisterAlertRoutes() {
 
 	database.ConnectDB()
-
-	http.HandleFunc("/alerts/create", createAlert)
-	http.HandleFunc("/alerts/getall", getAllAlerts)
-	http.HandleFunc("/alerts/recent", recentAlerts)
+	postgres.ConnectDB() // audit log
+
+	http.HandleFunc("/alerts/create", auth.Authorize("alerts", auth.ActionCreate, middleware.Idempotent(createAlert)))
+	http.HandleFunc("/alerts/getall", auth.Authorize("alerts", auth.ActionRead, getAllAlerts))
+	http.HandleFunc("/alerts/recent", auth.Authorize("alerts", auth.ActionRead, recentAlerts))
+	http.HandleFunc("GET /alerts/groups", auth.Authorize("alerts", auth.ActionRead, alertGroups))
+	http.HandleFunc("GET /alerts/search", auth.Authorize("alerts", auth.ActionRead, searchAlerts))
+	http.HandleFunc("GET /alerts/consumers", auth.Authorize("alerts", auth.ActionRead, alertConsumers))
+	http.HandleFunc("GET /silences", auth.Authorize("alerts", auth.ActionRead, getSilences))
+	http.HandleFunc("POST /silences/create", auth.Authorize("alerts", auth.ActionUpdate, createSilence))
+	http.HandleFunc("POST /silences/preview", auth.Authorize("alerts", auth.ActionRead, previewSilence))
+	http.HandleFunc("POST /silences/{uuid}/expire", auth.Authorize("alerts", auth.ActionUpdate, expireSilence))
+
+	http.HandleFunc("POST /alerts/{uuid}/ack", auth.Authorize("alerts", auth.ActionUpdate, ackAlert))
+	http.HandleFunc("POST /alerts/{uuid}/resolve", auth.Authorize("alerts", auth.ActionUpdate, resolveAlert))
 }
 
 func createAlert(w http.ResponseWriter, r *http.Request) {
@@ -77,3 +91,147 @@ func recentAlerts(w http.ResponseWriter, r *http.Request) {
 
 	util.RespondWithJSON(w, 200, &recentlerts)
 }
+
+func ackAlert(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	alert, err := database.AcknowledgeAlert(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &alert)
+}
+
+func resolveAlert(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	alert, err := database.ResolveAlert(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &alert)
+}
+
+func alertGroups(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	groups, err := database.GetAlertGroups(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &groups)
+}
+
+func getSilences(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	allSilences, err := database.GetAllSilences(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allSilences)
+}
+
+func createSilence(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	newSilence, err := database.CreateSilence(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &newSilence)
+}
+
+func previewSilence(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	matched, err := database.PreviewSilence(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &matched)
+}
+
+func expireSilence(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	silence, err := database.ExpireSilence(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &silence)
+}
+
+func searchAlerts(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	matched, err := database.SearchAlerts(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &matched)
+}
+
+func alertConsumers(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	groups, err := database.GetAlertConsumers(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &groups)
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterAuditRoutes() {
+
+	database.ConnectDB()
+
+	http.HandleFunc("GET /audit", auth.Authorize("audit", auth.ActionRead, getAuditLog))
+}
+
+func getAuditLog(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	entries, err := database.GetAuditLog(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &entries)
+}
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterAuthRoutes() {
+
+	database.ConnectDB()
+	redisdb.ConnectDB()
+
+	http.HandleFunc("/auth/login", login)
+	http.HandleFunc("/auth/refresh", refresh)
+	http.HandleFunc("/auth/logout", logout)
+	http.HandleFunc("/auth/password", auth.Authorize("users", auth.ActionUpdate, password))
+}
+
+func login(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	tokens, err := auth.Login(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &tokens)
+}
+
+func refresh(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	tokens, err := auth.Refresh(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &tokens)
+}
+
+func logout(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	err := auth.Logout(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Logged out"))
+}
+
+func password(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	err := database.SetPassword(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Password updated"))
+}
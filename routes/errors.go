@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	"github.com/i101dev/multimodal-db/jobs"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// respondWithStoreError maps the sentinel errors the stores and auth
+// return onto HTTP statuses; anything else is a 500.
+func respondWithStoreError(w http.ResponseWriter, err error) {
+
+	switch {
+	case errors.Is(err, database.ErrInvalidCredentials), errors.Is(err, auth.ErrInvalidToken):
+		util.RespondWithError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, database.ErrForbidden):
+		util.RespondWithError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, database.ErrPreconditionRequired):
+		util.RespondWithError(w, http.StatusPreconditionRequired, err.Error())
+	case errors.Is(err, database.ErrVersionMismatch):
+		util.RespondWithError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, database.ErrNameConflict):
+		util.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, redisdb.ErrAlertNotFound), errors.Is(err, redisdb.ErrWebhookNotFound),
+		errors.Is(err, redisdb.ErrDeadLetterNotFound), errors.Is(err, redisdb.ErrSilenceNotFound),
+		errors.Is(err, jobs.ErrJobNotFound):
+		util.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, redisdb.ErrInvalidTransition), errors.Is(err, jobs.ErrJobRunning):
+		util.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, database.ErrUnsupportedPatch):
+		util.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, database.ErrInvalidPatch), errors.Is(err, redisdb.ErrInvalidSilence),
+		errors.Is(err, redisdb.ErrInvalidSearch):
+		util.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		util.RespondWithError(w, 500, err.Error())
+	}
+}
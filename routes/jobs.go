@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	"github.com/i101dev/multimodal-db/jobs"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterJobRoutes() {
+
+	http.HandleFunc("GET /jobs", auth.Authorize("jobs", auth.ActionRead, getJobs))
+	http.HandleFunc("POST /jobs/{name}/run", auth.Authorize("jobs", auth.ActionUpdate, runJob))
+}
+
+func getJobs(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	statuses := jobs.List()
+	//
+	// -----------------------------------------------------------------
+
+	util.RespondWithJSON(w, 200, &statuses)
+}
+
+func runJob(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	status, err := jobs.Trigger(r.PathValue("name"))
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusAccepted, status)
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterKeyRoutes() {
+
+	database.ConnectDB()
+
+	http.HandleFunc("/keys/all", auth.Authorize("keys", auth.ActionRead, getAllKeys))
+	http.HandleFunc("/keys/create", auth.Authorize("keys", auth.ActionCreate, createKey))
+	http.HandleFunc("/keys/revoke", auth.Authorize("keys", auth.ActionDelete, revokeKey))
+}
+
+func getAllKeys(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	allKeys, err := database.GetAllAPIKeys(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allKeys)
+}
+
+func createKey(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	newKey, plaintext, err := database.CreateAPIKey(r, auth.Scopes)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	// The plaintext is only ever shown here.
+	util.RespondWithJSON(w, 200, struct {
+		*database.APIKey
+		Key string `json:"key"`
+	}{newKey, plaintext})
+}
+
+func revokeKey(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	keyDat, err := database.RevokeAPIKey(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &keyDat)
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/metrics"
+)
+
+func RegisterMetricsRoutes() {
+
+	http.Handle("/metrics", metrics.Handler())
+}
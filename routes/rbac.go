@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterRBACRoutes() {
+
+	database.ConnectDB()
+	auth.StartPolicyReloader()
+
+	http.HandleFunc("/rbac/policies", auth.Authorize("rbac", auth.ActionRead, getPolicies))
+	http.HandleFunc("/rbac/policies/grant", auth.Authorize("rbac", auth.ActionCreate, grantPolicy))
+	http.HandleFunc("/rbac/policies/revoke", auth.Authorize("rbac", auth.ActionDelete, revokePolicy))
+	http.HandleFunc("/rbac/bindings", auth.Authorize("rbac", auth.ActionRead, getBindings))
+	http.HandleFunc("/rbac/bindings/assign", auth.Authorize("rbac", auth.ActionCreate, assignRole))
+	http.HandleFunc("/rbac/bindings/remove", auth.Authorize("rbac", auth.ActionDelete, unassignRole))
+	http.HandleFunc("/rbac/reload", auth.Authorize("rbac", auth.ActionUpdate, reloadPolicies))
+}
+
+func getPolicies(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	allPolicies, err := database.LoadPolicies(r.Context())
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allPolicies)
+}
+
+func grantPolicy(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	newPolicy, err := database.GrantPolicy(r, auth.Roles)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = auth.ReloadPolicies(r.Context())
+	}
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &newPolicy)
+}
+
+func revokePolicy(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	err := database.RevokePolicy(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = auth.ReloadPolicies(r.Context())
+	}
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Policy revoked"))
+}
+
+func getBindings(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	allBindings, err := database.LoadRoleBindings(r.Context())
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allBindings)
+}
+
+func assignRole(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	binding, err := database.AssignRole(r, auth.Roles)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = auth.ReloadPolicies(r.Context())
+	}
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &binding)
+}
+
+func unassignRole(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	err := database.UnassignRole(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = auth.ReloadPolicies(r.Context())
+	}
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Role binding removed"))
+}
+
+func reloadPolicies(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// -----------------------------------------------------------------
+	//
+	err := auth.ReloadPolicies(r.Context())
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		util.RespondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Policies reloaded"))
+}
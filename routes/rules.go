@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/postgres"
+	"github.com/i101dev/multimodal-db/rules"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterRuleRoutes() {
+
+	database.ConnectDB()
+
+	http.HandleFunc("GET /rules", auth.Authorize("rules", auth.ActionRead, getRules))
+	http.HandleFunc("POST /rules/create", auth.Authorize("rules", auth.ActionCreate, createRule))
+	http.HandleFunc("DELETE /rules/delete", auth.Authorize("rules", auth.ActionDelete, deleteRule))
+}
+
+func getRules(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	allRules, err := database.LoadAlertRules(r.Context())
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allRules)
+}
+
+func createRule(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	newRule, err := database.CreateAlertRule(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = rules.Reload(r.Context())
+	}
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &newRule)
+}
+
+func deleteRule(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	err := database.DeleteAlertRule(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err == nil {
+		err = rules.Reload(r.Context())
+	}
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Rule deleted"))
+}
@@ -3,6 +3,9 @@ package routes
 import (
 	"net/http"
 
+	"github.com/i101dev/multimodal-db/auth"
+	"github.com/i101dev/multimodal-db/middleware"
+	"github.com/i101dev/multimodal-db/models/postgres"
 	"github.com/i101dev/multimodal-db/util"
 
 	database "github.com/i101dev/multimodal-db/models/badger"
@@ -10,9 +13,12 @@ import (
 
 func RegisterTxnRoutes() {
 
-	http.HandleFunc("/txn/create", createTxn)
-	http.HandleFunc("/txn/getall", getAllTxns)
-	http.HandleFunc("/txn/recent", recentTxns)
+	database.ConnectDB()
+	postgres.ConnectDB() // audit log
+
+	http.HandleFunc("/txn/create", auth.Authorize("txns", auth.ActionCreate, middleware.Idempotent(createTxn)))
+	http.HandleFunc("/txn/getall", auth.Authorize("txns", auth.ActionRead, getAllTxns))
+	http.HandleFunc("/txn/recent", auth.Authorize("txns", auth.ActionRead, recentTxns))
 }
 
 func createTxn(w http.ResponseWriter, r *http.Request) {
@@ -5,29 +5,38 @@ import (
 
 	database "github.com/i101dev/multimodal-db/models/postgres"
 	// database "github.com/i101dev/multimodal-db/models/mysql"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
 
+	"github.com/i101dev/multimodal-db/auth"
+	"github.com/i101dev/multimodal-db/middleware"
 	"github.com/i101dev/multimodal-db/util"
 )
 
 func RegisterUserRoutes() {
 
 	database.ConnectDB()
-
-	http.HandleFunc("/users/all", getAll)
-	http.HandleFunc("/users/find", find)
-	http.HandleFunc("/users/create", create)
-	http.HandleFunc("/users/update", update)
-	http.HandleFunc("/users/delete", delete)
-	http.HandleFunc("/users/addskill", addskill)
-	http.HandleFunc("/users/removeskill", removeskill)
+	redisdb.StartUserCache()
+
+	http.HandleFunc("GET /users/all", auth.Authorize("users", auth.ActionRead, getAll))
+	http.HandleFunc("POST /users/find", auth.Authorize("users", auth.ActionRead, find))
+	http.HandleFunc("POST /users/create", auth.Authorize("users", auth.ActionCreate, middleware.Idempotent(create)))
+	http.HandleFunc("PUT /users/update", auth.Authorize("users", auth.ActionUpdate, update))
+	http.HandleFunc("DELETE /users/delete", auth.Authorize("users", auth.ActionDelete, delete))
+	http.HandleFunc("POST /users/addskill", auth.Authorize("users", auth.ActionUpdate, addskill))
+	http.HandleFunc("POST /users/removeskill", auth.Authorize("users", auth.ActionUpdate, removeskill))
+	http.HandleFunc("PATCH /users/{uuid}", auth.Authorize("users", auth.ActionUpdate, patch))
+
+	http.HandleFunc("GET /users/{uuid}", auth.Authorize("users", auth.ActionRead, get))
+	http.HandleFunc("GET /users/{uuid}/revisions", auth.Authorize("users", auth.ActionRead, getRevisions))
+	http.HandleFunc("POST /users/{uuid}/revert", auth.Authorize("users", auth.ActionUpdate, revert))
+
+	// Managing deleted users takes the right to delete them.
+	http.HandleFunc("GET /users/deleted", auth.Authorize("users", auth.ActionDelete, getDeleted))
+	http.HandleFunc("POST /users/restore", auth.Authorize("users", auth.ActionDelete, restore))
+	http.HandleFunc("DELETE /users/purge", auth.Authorize("users", auth.ActionDelete, purge))
 }
 func getAll(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// -----------------------------------------------------------------
 	//
 	allUsers, err := database.GetAllUsers(r)
@@ -35,7 +44,7 @@ func getAll(w http.ResponseWriter, r *http.Request) {
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
@@ -44,11 +53,6 @@ func getAll(w http.ResponseWriter, r *http.Request) {
 
 func find(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// -----------------------------------------------------------------
 	//
 	newUser, err := database.FindUserByID(r)
@@ -56,20 +60,16 @@ func find(w http.ResponseWriter, r *http.Request) {
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", newUser.ETag())
 	util.RespondWithJSON(w, 200, &newUser)
 }
 
 func create(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// -----------------------------------------------------------------
 	//
 	newUser, err := database.CreateUser(r)
@@ -77,20 +77,16 @@ func create(w http.ResponseWriter, r *http.Request) {
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", newUser.ETag())
 	util.RespondWithJSON(w, 200, &newUser)
 }
 
 func update(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// -----------------------------------------------------------------
 	//
 	newUser, err := database.UpdateUser(r)
@@ -98,20 +94,16 @@ func update(w http.ResponseWriter, r *http.Request) {
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", newUser.ETag())
 	util.RespondWithJSON(w, 200, &newUser)
 }
 
 func delete(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// -----------------------------------------------------------------
 	//
 	err := database.DeleteUser(r)
@@ -119,7 +111,7 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
@@ -129,42 +121,154 @@ func delete(w http.ResponseWriter, r *http.Request) {
 
 func addskill(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// -----------------------------------------------------------------
+	//
+	userDat, err := database.AddSkill(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", userDat.ETag())
+	util.RespondWithJSON(w, 200, &userDat)
+}
+
+func removeskill(w http.ResponseWriter, r *http.Request) {
+
 	// -----------------------------------------------------------------
 	//
-	userDat, err := database.AddSkill(r)
+	userDat, err := database.RemoveSkill(r)
 	//
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", userDat.ETag())
 	util.RespondWithJSON(w, 200, &userDat)
 }
 
-func removeskill(w http.ResponseWriter, r *http.Request) {
+func patch(w http.ResponseWriter, r *http.Request) {
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// -----------------------------------------------------------------
+	//
+	userDat, err := database.PatchUser(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", userDat.ETag())
+	util.RespondWithJSON(w, 200, &userDat)
+}
+
+func getDeleted(w http.ResponseWriter, r *http.Request) {
+
 	// -----------------------------------------------------------------
 	//
-	userDat, err := database.RemoveSkill(r)
+	deletedUsers, err := database.GetDeletedUsers(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &deletedUsers)
+}
+
+func restore(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	userDat, err := database.RestoreUser(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", userDat.ETag())
+	util.RespondWithJSON(w, 200, &userDat)
+}
+
+func purge(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	err := database.PurgeUser(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("User purged"))
+}
+
+func get(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	userDat, err := database.GetUser(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	// A past revision isn't something a write can be conditioned on.
+	if r.URL.Query().Get("as_of") == "" {
+		w.Header().Set("ETag", userDat.ETag())
+	}
+	util.RespondWithJSON(w, 200, &userDat)
+}
+
+func getRevisions(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	revisions, err := database.GetUserRevisions(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &revisions)
+}
+
+func revert(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	userDat, err := database.RevertUser(r)
 	//
 	// -----------------------------------------------------------------
 
 	if err != nil {
-		util.RespondWithError(w, 500, err.Error())
+		respondWithStoreError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", userDat.ETag())
 	util.RespondWithJSON(w, 200, &userDat)
 }
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/i101dev/multimodal-db/auth"
+	database "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+func RegisterWebhookRoutes() {
+
+	database.ConnectDB()
+
+	http.HandleFunc("GET /webhooks", auth.Authorize("webhooks", auth.ActionRead, getWebhooks))
+	http.HandleFunc("POST /webhooks/create", auth.Authorize("webhooks", auth.ActionCreate, createWebhook))
+	http.HandleFunc("DELETE /webhooks/delete", auth.Authorize("webhooks", auth.ActionDelete, deleteWebhook))
+	http.HandleFunc("GET /webhooks/deliveries", auth.Authorize("webhooks", auth.ActionRead, getDeliveries))
+	http.HandleFunc("GET /webhooks/dead-letters", auth.Authorize("webhooks", auth.ActionRead, getDeadLetters))
+	http.HandleFunc("POST /webhooks/dead-letters/retry", auth.Authorize("webhooks", auth.ActionUpdate, retryDeadLetter))
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	allWebhooks, err := database.GetAllWebhooks(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &allWebhooks)
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	newWebhook, err := database.CreateWebhook(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	// The secret is only ever shown here.
+	util.RespondWithJSON(w, 200, &newWebhook)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	err := database.DeleteWebhook(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("Webhook deleted"))
+}
+
+func getDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	attempts, err := database.GetDeliveryLog(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &attempts)
+}
+
+func getDeadLetters(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	deadLetters, err := database.GetDeadLetters(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &deadLetters)
+}
+
+func retryDeadLetter(w http.ResponseWriter, r *http.Request) {
+
+	// -----------------------------------------------------------------
+	//
+	delivery, err := database.RetryDeadLetter(r)
+	//
+	// -----------------------------------------------------------------
+
+	if err != nil {
+		respondWithStoreError(w, err)
+		return
+	}
+
+	util.RespondWithJSON(w, 200, &delivery)
+}
@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sync/atomic"
+	"time"
+
+	badgerdb "github.com/i101dev/multimodal-db/models/badger"
+	"github.com/i101dev/multimodal-db/models/postgres"
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const defaultReloadInterval = 30 * time.Second
+
+type rule struct {
+	postgres.AlertRule
+	window time.Duration
+}
+
+var current atomic.Pointer[[]rule]
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Start loads the alert rules and evaluates every new txn against them,
+// reloading the rules every ALERT_RULES_RELOAD_INTERVAL (default 30s).
+func Start() {
+
+	postgres.ConnectDB()
+	redisdb.ConnectDB()
+	badgerdb.ConnectDB()
+
+	if err := Reload(context.Background()); err != nil {
+		log.Fatal("Error loading alert rules:", err)
+	}
+
+	interval := util.EnvDuration("ALERT_RULES_RELOAD_INTERVAL", defaultReloadInterval)
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := Reload(context.Background()); err != nil {
+				log.Println("Error reloading alert rules:", err)
+			}
+		}
+	}()
+
+	badgerdb.OnTxnCreated(evaluate)
+}
+
+// Reload re-reads the alert rules from Postgres.
+func Reload(ctx context.Context) error {
+
+	rows, err := postgres.LoadAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]rule, 0, len(rows))
+
+	for _, row := range rows {
+		window, _ := time.ParseDuration(row.Window)
+		loaded = append(loaded, rule{AlertRule: row, window: window})
+	}
+
+	current.Store(&loaded)
+
+	return nil
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func evaluate(ctx context.Context, txn badgerdb.Txn) {
+
+	loaded := current.Load()
+	if loaded == nil {
+		return
+	}
+
+	for _, rl := range *loaded {
+
+		if !rl.matches(txn) {
+			continue
+		}
+
+		if err := rl.fire(ctx, txn); err != nil {
+			log.Printf("Error evaluating alert rule [%s]: %v", rl.Name, err)
+		}
+	}
+}
+
+func (rl *rule) matches(txn badgerdb.Txn) bool {
+
+	if ok, _ := path.Match(rl.Code, txn.Code); rl.Code != "" && !ok {
+		return false
+	}
+	if ok, _ := path.Match(rl.Item, txn.Item); rl.Item != "" && !ok {
+		return false
+	}
+
+	return true
+}
+
+func (rl *rule) fire(ctx context.Context, txn badgerdb.Txn) error {
+
+	txnUUIDs := []string{txn.UUID}
+
+	if rl.Threshold > 0 {
+
+		fired, err := redisdb.ObserveRuleMatch(ctx, rl.UUID, txn.UUID, rl.window, rl.Threshold)
+		if err != nil {
+			return err
+		}
+		if len(fired) == 0 {
+			return nil
+		}
+
+		txnUUIDs = fired
+	}
+
+	title := rl.Title
+	if title == "" {
+		title = rl.Name
+	}
+
+	body := fmt.Sprintf("rule [%s] matched txn [%s]", rl.Name, txn.UUID)
+	if rl.Threshold > 0 {
+		body = fmt.Sprintf("rule [%s] matched %d txns within %s", rl.Name, len(txnUUIDs), rl.Window)
+	}
+
+	ctx = postgres.WithActor(ctx, "rule:"+rl.UUID)
+
+	return redisdb.RaiseAlert(ctx, &redisdb.Alert{
+		Title:    title,
+		Body:     body,
+		Source:   "rule",
+		Rule:     rl.UUID,
+		TxnUUIDs: txnUUIDs,
+	})
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"errors"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin opens a client span around every gorm statement, parented to
+// the context the statement was issued with. System is the semconv
+// db.system value ("postgresql", "mysql").
+type GormPlugin struct {
+	System string
+}
+
+func (p GormPlugin) Name() string {
+	return "tracing:" + p.System
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register(p.Name()+":before_create", p.before("create")); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register(p.Name()+":after_create", p.after); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(p.Name()+":before_query", p.before("query")); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register(p.Name()+":after_query", p.after); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(p.Name()+":before_update", p.before("update")); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register(p.Name()+":after_update", p.after); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register(p.Name()+":before_delete", p.before("delete")); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register(p.Name()+":after_delete", p.after); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(p.Name()+":before_row", p.before("row")); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register(p.Name()+":after_row", p.after); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register(p.Name()+":before_raw", p.before("raw")); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register(p.Name()+":after_raw", p.after)
+}
+
+func (p GormPlugin) before(operation string) func(*gorm.DB) {
+
+	return func(tx *gorm.DB) {
+
+		ctx, span := Start(tx.Statement.Context, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			dbAttributes(semconv.DBSystemKey.String(p.System), operation),
+		)
+
+		tx.Statement.Context = ctx
+		tx.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func (p GormPlugin) after(tx *gorm.DB) {
+
+	v, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+
+	span.SetAttributes(
+		semconv.DBQueryText(tx.Statement.SQL.String()),
+		semconv.DBCollectionName(tx.Statement.Table),
+	)
+
+	// A missing row is an answer, not a datastore failure.
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+
+	End(span, err)
+}
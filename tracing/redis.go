@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// RedisHook opens a client span around every go-redis command and
+// pipeline, parented to the context the command was issued with.
+type RedisHook struct{}
+
+// Dials happen on behalf of the pool rather than any one request, so
+// they aren't worth a span of their own.
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+
+	return func(ctx context.Context, cmd redis.Cmder) error {
+
+		ctx, span := Start(ctx, "redis."+cmd.Name(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			dbAttributes(semconv.DBSystemRedis, cmd.Name()),
+		)
+
+		err := next(ctx, cmd)
+		End(span, redisErr(err))
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+
+		ctx, span := Start(ctx, "redis.pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			dbAttributes(semconv.DBSystemRedis, "pipeline"),
+		)
+
+		err := next(ctx, cmds)
+		End(span, redisErr(err))
+		return err
+	}
+}
+
+// redis.Nil only means the key wasn't there.
+func redisErr(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
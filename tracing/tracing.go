@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	serviceName = "multimodal-db"
+	tracerName  = "github.com/i101dev/multimodal-db"
+)
+
+var provider *sdktrace.TracerProvider
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Init installs the global tracer provider and W3C propagators.
+//
+//	TRACING_EXPORTER  otlp | stdout | file | none (default none)
+//	TRACING_FILE      output path for the file exporter (default ./tmp/traces.json)
+//
+// The OTLP exporter reads the standard OTEL_EXPORTER_OTLP_* variables.
+func Init() {
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter := os.Getenv("TRACING_EXPORTER")
+
+	if exporter == "" || exporter == "none" {
+		return
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		log.Fatal("Error building trace resource:", err)
+	}
+
+	var opt sdktrace.TracerProviderOption
+
+	switch exporter {
+	case "otlp":
+		exp, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			log.Fatal("Error creating OTLP exporter:", err)
+		}
+		opt = sdktrace.WithBatcher(exp)
+
+	case "stdout":
+		opt = sdktrace.WithSyncer(newWriterExporter(os.Stdout))
+
+	case "file":
+		path := os.Getenv("TRACING_FILE")
+		if path == "" {
+			path = "./tmp/traces.json"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal("Error opening trace file:", err)
+		}
+		opt = sdktrace.WithSyncer(newWriterExporter(f))
+
+	default:
+		log.Fatalf("invalid TRACING_EXPORTER %q", exporter)
+	}
+
+	provider = sdktrace.NewTracerProvider(opt, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	fmt.Println("Tracing enabled with exporter:", exporter)
+}
+
+// Shutdown flushes any spans still buffered by the exporter.
+func Shutdown(ctx context.Context) {
+	if provider != nil {
+		provider.Shutdown(ctx)
+	}
+}
+
+// Start opens a span on the service tracer.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// Middleware starts a server span for each request, continuing any trace
+// passed in via a traceparent header and echoing the span context back on
+// the response so clients can correlate.
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+
+	propagator := otel.GetTextMapPropagator()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+		rec := util.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status))
+		if rec.Status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func newWriterExporter(w io.Writer) sdktrace.SpanExporter {
+
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		log.Fatal("Error creating trace exporter:", err)
+	}
+
+	return exp
+}
+
+func dbAttributes(system attribute.KeyValue, operation string) trace.SpanStartOption {
+	return trace.WithAttributes(system, semconv.DBOperationName(operation))
+}
@@ -1,9 +1,12 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 )
 
 func RespondWithError(w http.ResponseWriter, code int, msg string) {
@@ -54,3 +57,52 @@ func ParseBody(r *http.Request, x interface{}) error {
 	}
 	return nil
 }
+
+// StatusRecorder remembers the status code written through it so
+// middleware can inspect the outcome of a request after the fact.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (s *StatusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.Status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID and RequestID carry the ID the request ID middleware
+// assigned, so anything recording work done for a request can name it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// EnvDuration reads a positive duration from the environment, falling
+// back when it's unset or invalid.
+func EnvDuration(name string, fallback time.Duration) time.Duration {
+
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+
+	return fallback
+}
@@ -0,0 +1,270 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+	"github.com/i101dev/multimodal-db/util"
+)
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+const (
+	defaultPollInterval = time.Second
+	defaultMaxAttempts  = 8
+	defaultTimeout      = 10 * time.Second
+
+	batchSize  = 20
+	baseDelay  = 2 * time.Second
+	maxDelay   = time.Hour
+	userAgent  = "multimodal-db-webhooks/1"
+	bodyLimit  = 512
+	leaseSlack = 30 * time.Second
+)
+
+// Headers sent with every delivery. The signature is an HMAC-SHA256, keyed
+// with the webhook's secret, over "<timestamp>.<body>".
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+type dispatcher struct {
+	queue       queue
+	client      *http.Client
+	maxAttempts int
+	lease       time.Duration
+}
+
+// queue is where the dispatcher claims deliveries and reports how they
+// went: the Redis webhook queue, or a stand-in in tests.
+type queue interface {
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]redisdb.WebhookDelivery, error)
+	GetWebhook(ctx context.Context, webhookUUID string) (*redisdb.Webhook, error)
+	CompleteDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error
+	RetryDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, at time.Time, attempt redisdb.DeliveryAttempt) error
+	DeadLetterDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+// StartDispatcher delivers queued alert webhooks in the background.
+//
+//	WEBHOOK_POLL_INTERVAL  how often to look for due deliveries (default 1s)
+//	WEBHOOK_MAX_ATTEMPTS   attempts before a delivery is dead-lettered (default 8)
+//	WEBHOOK_TIMEOUT        per-attempt HTTP timeout (default 10s)
+//
+// Failed attempts are retried with exponential backoff, starting at 2s
+// and capped at 1h, with jitter.
+func StartDispatcher() {
+
+	redisdb.ConnectDB()
+
+	interval := util.EnvDuration("WEBHOOK_POLL_INTERVAL", defaultPollInterval)
+	d := newDispatcher(redisQueue{})
+
+	go func() {
+		for range time.Tick(interval) {
+			d.poll(context.Background())
+		}
+	}()
+}
+
+func newDispatcher(q queue) *dispatcher {
+
+	timeout := util.EnvDuration("WEBHOOK_TIMEOUT", defaultTimeout)
+
+	maxAttempts := defaultMaxAttempts
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		maxAttempts = n
+	}
+
+	return &dispatcher{
+		queue:       q,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		lease:       timeout + leaseSlack,
+	}
+}
+
+// Sign computes the signature header value for body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func (d *dispatcher) poll(ctx context.Context) {
+
+	deliveries, err := d.queue.ClaimDeliveries(ctx, batchSize, d.lease)
+	if err != nil {
+		log.Println("Error claiming webhook deliveries:", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *redisdb.WebhookDelivery) {
+			defer wg.Done()
+			d.process(ctx, delivery)
+		}(&deliveries[i])
+	}
+
+	wg.Wait()
+}
+
+func (d *dispatcher) process(ctx context.Context, delivery *redisdb.WebhookDelivery) {
+
+	delivery.Attempts++
+
+	attempt := redisdb.DeliveryAttempt{
+		DeliveryID:  delivery.ID,
+		WebhookUUID: delivery.WebhookUUID,
+		AlertUUID:   delivery.AlertUUID,
+		Attempt:     delivery.Attempts,
+		Timestamp:   time.Now().Unix(),
+	}
+
+	webhook, err := d.queue.GetWebhook(ctx, delivery.WebhookUUID)
+
+	// The subscription was deleted after this was queued.
+	if errors.Is(err, redisdb.ErrWebhookNotFound) {
+		attempt.Outcome = "dropped"
+		attempt.Error = err.Error()
+		d.record(d.queue.CompleteDelivery(ctx, delivery, attempt))
+		return
+	}
+	if err != nil {
+		log.Println("Error loading webhook", delivery.WebhookUUID+":", err)
+		return
+	}
+
+	// ----------------------------------------------------------------
+	start := time.Now()
+	status, err := d.send(ctx, webhook, delivery)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	attempt.StatusCode = status
+
+	if err == nil {
+		attempt.Outcome = "delivered"
+		d.record(d.queue.CompleteDelivery(ctx, delivery, attempt))
+		return
+	}
+
+	attempt.Error = err.Error()
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.maxAttempts {
+		attempt.Outcome = "dead-lettered"
+		d.record(d.queue.DeadLetterDelivery(ctx, delivery, attempt))
+		return
+	}
+
+	attempt.Outcome = "retrying"
+	d.record(d.queue.RetryDelivery(ctx, delivery, time.Now().Add(backoff(delivery.Attempts)), attempt))
+}
+
+// send makes one delivery attempt. Any 2xx is success.
+func (d *dispatcher) send(ctx context.Context, webhook *redisdb.Webhook, delivery *redisdb.WebhookDelivery) (int, error) {
+
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, bodyLimit))
+		return resp.StatusCode, fmt.Errorf("receiver answered %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+func (d *dispatcher) record(err error) {
+	if err != nil {
+		log.Println("Error recording webhook delivery:", err)
+	}
+}
+
+// backoff doubles from baseDelay with each attempt, up to maxDelay, plus
+// up to 20% jitter so failed deliveries don't retry in lockstep.
+func backoff(attempts int) time.Duration {
+
+	delay := maxDelay
+	if attempts < 32 {
+		if d := baseDelay << (attempts - 1); d > 0 && d < maxDelay {
+			delay = d
+		}
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+type redisQueue struct{}
+
+func (redisQueue) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]redisdb.WebhookDelivery, error) {
+	return redisdb.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (redisQueue) GetWebhook(ctx context.Context, webhookUUID string) (*redisdb.Webhook, error) {
+	return redisdb.GetWebhook(ctx, webhookUUID)
+}
+
+func (redisQueue) CompleteDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error {
+	return redisdb.CompleteDelivery(ctx, delivery, attempt)
+}
+
+func (redisQueue) RetryDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, at time.Time, attempt redisdb.DeliveryAttempt) error {
+	return redisdb.RetryDelivery(ctx, delivery, at, attempt)
+}
+
+func (redisQueue) DeadLetterDelivery(ctx context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error {
+	return redisdb.DeadLetterDelivery(ctx, delivery, attempt)
+}
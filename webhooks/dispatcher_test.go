@@ -0,0 +1,281 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redisdb "github.com/i101dev/multimodal-db/models/redis"
+)
+
+const testSecret = "whsec_test"
+
+// fakeQueue hands out every queued delivery on each claim and keeps what
+// the dispatcher reports back.
+type fakeQueue struct {
+	mu       sync.Mutex
+	webhook  redisdb.Webhook
+	queued   []redisdb.WebhookDelivery
+	retryAt  []time.Time
+	done     []redisdb.WebhookDelivery
+	dead     map[string]redisdb.WebhookDelivery
+	attempts []redisdb.DeliveryAttempt
+}
+
+func newFakeQueue(url string, deliveries ...redisdb.WebhookDelivery) *fakeQueue {
+	return &fakeQueue{
+		webhook: redisdb.Webhook{UUID: "hook-1", URL: url, Secret: testSecret},
+		queued:  deliveries,
+		dead:    map[string]redisdb.WebhookDelivery{},
+	}
+}
+
+func (q *fakeQueue) ClaimDeliveries(_ context.Context, limit int, _ time.Duration) ([]redisdb.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	claimed := q.queued
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	q.queued = q.queued[len(claimed):]
+
+	return claimed, nil
+}
+
+func (q *fakeQueue) GetWebhook(_ context.Context, webhookUUID string) (*redisdb.Webhook, error) {
+	if webhookUUID != q.webhook.UUID {
+		return nil, redisdb.ErrWebhookNotFound
+	}
+	webhook := q.webhook
+	return &webhook, nil
+}
+
+func (q *fakeQueue) CompleteDelivery(_ context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.done = append(q.done, *delivery)
+	q.attempts = append(q.attempts, attempt)
+	return nil
+}
+
+func (q *fakeQueue) RetryDelivery(_ context.Context, delivery *redisdb.WebhookDelivery, at time.Time, attempt redisdb.DeliveryAttempt) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queued = append(q.queued, *delivery)
+	q.retryAt = append(q.retryAt, at)
+	q.attempts = append(q.attempts, attempt)
+	return nil
+}
+
+func (q *fakeQueue) DeadLetterDelivery(_ context.Context, delivery *redisdb.WebhookDelivery, attempt redisdb.DeliveryAttempt) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.dead[delivery.ID] = *delivery
+	q.attempts = append(q.attempts, attempt)
+	return nil
+}
+
+// receiver answers every delivery with status and counts the deliveries
+// whose signature checks out against testSecret.
+type receiver struct {
+	*httptest.Server
+	status   atomic.Int32
+	received atomic.Int32
+	verified atomic.Int32
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+
+	rc := &receiver{}
+	rc.status.Store(int32(status))
+
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		rc.received.Add(1)
+
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(HeaderTimestamp)
+
+		mac := hmac.New(sha256.New, []byte(testSecret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		if hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderSignature))) {
+			rc.verified.Add(1)
+		}
+
+		w.WriteHeader(int(rc.status.Load()))
+	}))
+	t.Cleanup(rc.Close)
+
+	return rc
+}
+
+func testDelivery(id string) redisdb.WebhookDelivery {
+	return redisdb.WebhookDelivery{
+		ID:          id,
+		WebhookUUID: "hook-1",
+		AlertUUID:   "alert-" + id,
+		Event:       redisdb.EventAlertCreated,
+		Payload:     `{"uuid":"alert-` + id + `","title":"disk full"}`,
+	}
+}
+
+// --------------------------------------------------------------------
+// --------------------------------------------------------------------
+
+func TestDeliverySignedAndCompleted(t *testing.T) {
+
+	rc := newReceiver(t, http.StatusNoContent)
+	q := newFakeQueue(rc.URL, testDelivery("d1"))
+
+	newDispatcher(q).poll(context.Background())
+
+	if rc.received.Load() != 1 {
+		t.Fatalf("receiver got %d deliveries, want 1", rc.received.Load())
+	}
+	if rc.verified.Load() != 1 {
+		t.Fatal("signature did not verify against the webhook secret")
+	}
+	if len(q.done) != 1 || q.done[0].ID != "d1" {
+		t.Fatalf("delivery not completed: %+v", q.done)
+	}
+	if len(q.queued) != 0 || len(q.dead) != 0 {
+		t.Fatalf("delivered delivery still queued or dead-lettered")
+	}
+	if got := q.attempts[0]; got.Outcome != "delivered" || got.StatusCode != http.StatusNoContent || got.Attempt != 1 {
+		t.Fatalf("unexpected attempt log: %+v", got)
+	}
+}
+
+func TestSignatureMatchesSign(t *testing.T) {
+
+	body := []byte(`{"uuid":"a"}`)
+	timestamp := int64(1700000000)
+
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + string(body)))
+
+	if got, want := Sign(testSecret, timestamp, body), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", timestamp, body) == Sign(testSecret, timestamp, body) {
+		t.Fatal("signature does not depend on the secret")
+	}
+}
+
+func TestServerErrorRetriedWithBackoff(t *testing.T) {
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "5")
+
+	rc := newReceiver(t, http.StatusServiceUnavailable)
+	q := newFakeQueue(rc.URL, testDelivery("d1"))
+	d := newDispatcher(q)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+
+		before := time.Now()
+		d.poll(context.Background())
+
+		if len(q.retryAt) != attempt {
+			t.Fatalf("attempt %d: %d retries scheduled, want %d", attempt, len(q.retryAt), attempt)
+		}
+
+		// 2s, 4s, 8s, each with up to 20% jitter.
+		delay := q.retryAt[attempt-1].Sub(before)
+		base := baseDelay << (attempt - 1)
+
+		if delay < base || delay > base+base/5+time.Second {
+			t.Fatalf("attempt %d: retry in %v, want %v plus jitter", attempt, delay, base)
+		}
+
+		logged := q.attempts[attempt-1]
+		if logged.Outcome != "retrying" || logged.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("attempt %d: unexpected attempt log: %+v", attempt, logged)
+		}
+	}
+
+	if len(q.queued) != 1 || q.queued[0].Attempts != 3 {
+		t.Fatalf("delivery should be requeued after 3 attempts: %+v", q.queued)
+	}
+	if !strings.Contains(q.queued[0].LastError, "503") {
+		t.Fatalf("last error %q doesn't name the status", q.queued[0].LastError)
+	}
+	if len(q.done) != 0 || len(q.dead) != 0 {
+		t.Fatal("failing delivery completed or dead-lettered early")
+	}
+}
+
+func TestDeadLetteredAfterMaxAttempts(t *testing.T) {
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+
+	rc := newReceiver(t, http.StatusInternalServerError)
+	q := newFakeQueue(rc.URL, testDelivery("d1"))
+	d := newDispatcher(q)
+
+	for i := 0; i < 5; i++ {
+		d.poll(context.Background())
+	}
+
+	if rc.received.Load() != 3 {
+		t.Fatalf("receiver got %d attempts, want 3", rc.received.Load())
+	}
+
+	dead, ok := q.dead["d1"]
+	if !ok {
+		t.Fatal("delivery not dead-lettered")
+	}
+	if dead.Attempts != 3 {
+		t.Fatalf("dead letter has %d attempts, want 3", dead.Attempts)
+	}
+	if len(q.queued) != 0 || len(q.done) != 0 {
+		t.Fatal("dead-lettered delivery still queued or completed")
+	}
+	if last := q.attempts[len(q.attempts)-1]; last.Outcome != "dead-lettered" {
+		t.Fatalf("last attempt outcome %q, want dead-lettered", last.Outcome)
+	}
+
+	// A receiver that recovers gets a retried dead letter on the first try.
+	rc.status.Store(http.StatusOK)
+	dead.Attempts = 0
+	q.queued = append(q.queued, dead)
+
+	d.poll(context.Background())
+
+	if len(q.done) != 1 {
+		t.Fatal("requeued dead letter not delivered")
+	}
+}
+
+func TestDeletedWebhookDropped(t *testing.T) {
+
+	rc := newReceiver(t, http.StatusOK)
+
+	delivery := testDelivery("d1")
+	delivery.WebhookUUID = "gone"
+	q := newFakeQueue(rc.URL, delivery)
+
+	newDispatcher(q).poll(context.Background())
+
+	if rc.received.Load() != 0 {
+		t.Fatal("delivery for a deleted webhook was sent")
+	}
+	if len(q.done) != 1 || q.attempts[0].Outcome != "dropped" {
+		t.Fatalf("delivery for a deleted webhook not dropped: %+v", q.attempts)
+	}
+}